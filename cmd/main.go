@@ -8,6 +8,10 @@ import (
 	"github.com/k4zb3k/project/internal/repository"
 	"github.com/k4zb3k/project/internal/service"
 	"github.com/k4zb3k/project/pkg/logger"
+	"github.com/k4zb3k/project/pkg/mailer"
+	"github.com/k4zb3k/project/pkg/notifier"
+	"github.com/k4zb3k/project/pkg/oidc"
+	"github.com/k4zb3k/project/pkg/password"
 	"github.com/k4zb3k/project/pkg/redis"
 	"github.com/k4zb3k/project/utils"
 	"net"
@@ -22,6 +26,13 @@ func main() {
 	cfg := config.GetConfig()
 	logger.Info.Println(cfg)
 
+	// по умолчанию gin верит X-Forwarded-For от любого клиента, а по ClientIP
+	// считаются лимиты входа и регистраций
+	if err := router.SetTrustedProxies(cfg.Listen.TrustedProxies); err != nil {
+		logger.Error.Println("invalid trusted proxies: ", err)
+		return
+	}
+
 	redisClient, err := redis.InitRedis(cfg.CacheConn)
 	if err != nil {
 		logger.Error.Println("failed to connect Redis: ", err)
@@ -36,7 +47,53 @@ func main() {
 
 	newRepository := repository.NewRepository(dbConn)
 
-	newService := service.NewService(newRepository, redisClient)
+	accessKeys, err := service.NewKeyRing(cfg.JwtConfig.AccessKeys, cfg.JwtConfig.AccessSecret)
+	if err != nil {
+		logger.Error.Println("failed to load access token keys: ", err)
+		return
+	}
+
+	refreshKeys, err := service.NewKeyRing(cfg.JwtConfig.RefreshKeys, cfg.JwtConfig.RefreshSecret)
+	if err != nil {
+		logger.Error.Println("failed to load refresh token keys: ", err)
+		return
+	}
+
+	mailSender, err := mailer.NewMailer(cfg.Mail)
+	if err != nil {
+		logger.Error.Println("failed to init mailer: ", err)
+		return
+	}
+
+	passwordPolicy, err := password.NewPolicy(cfg.PasswordPolicy)
+	if err != nil {
+		logger.Error.Println("failed to load password policy: ", err)
+		return
+	}
+
+	oidcProvider := oidc.NewProvider(cfg.Oidc)
+
+	webAuthn, err := service.NewWebAuthn(cfg.WebAuthn)
+	if err != nil {
+		logger.Error.Println("failed to init webauthn: ", err)
+		return
+	}
+
+	securityNotifier, err := notifier.NewNotifier(cfg.Notifier, mailSender)
+	if err != nil {
+		logger.Error.Println("failed to init notifier: ", err)
+		return
+	}
+
+	newService := service.NewService(newRepository, redisClient, cfg, accessKeys, refreshKeys, mailSender, passwordPolicy,
+		oidcProvider, webAuthn, securityNotifier)
+
+	if cfg.FxRates.ImportOnStart {
+		// без курсов сервис работает, не пересчитываются только отчеты в другой валюте
+		if _, err := newService.ImportRatesFile(); err != nil {
+			logger.Error.Println("failed to import fx rates: ", err)
+		}
+	}
 
 	newHandler := handler.NewHandler(router, newService)
 	newHandler.InitRoutes()
@@ -4,21 +4,40 @@ import (
 	"github.com/ilyakaznacheev/cleanenv"
 	"github.com/k4zb3k/project/pkg/logger"
 	"sync"
+	"time"
 )
 
 type Config struct {
-	IsDebug      *bool              `yaml:"is_debug" env-required:"true"`
-	Listen       ListenConfig       `yaml:"listen"`
-	DatabaseConn DatabaseConnConfig `yaml:"database_conn"`
-	CacheConn    CacheConnConfig    `yaml:"cache_conn"`
-	BrokerConn   BrokerConnConfig   `yaml:"broker_conn"`
-	JwtConfig    JWTConfig          `yaml:"jwt_config"`
+	IsDebug        *bool                `yaml:"is_debug" env-required:"true"`
+	Listen         ListenConfig         `yaml:"listen"`
+	DatabaseConn   DatabaseConnConfig   `yaml:"database_conn"`
+	CacheConn      CacheConnConfig      `yaml:"cache_conn"`
+	BrokerConn     BrokerConnConfig     `yaml:"broker_conn"`
+	JwtConfig      JWTConfig            `yaml:"jwt_config"`
+	Totp           TotpConfig           `yaml:"totp"`
+	LoginLimit     LoginLimitConfig     `yaml:"login_limit"`
+	Mail           MailConfig           `yaml:"mail"`
+	PasswordReset  PasswordResetConfig  `yaml:"password_reset"`
+	PasswordPolicy PasswordPolicyConfig `yaml:"password_policy"`
+	PasswordHash   PasswordHashConfig   `yaml:"password_hash"`
+	EmailVerify    EmailVerifyConfig    `yaml:"email_verify"`
+	Oidc           OidcConfig           `yaml:"oidc"`
+	StepUp         StepUpConfig         `yaml:"step_up"`
+	WebAuthn       WebAuthnConfig       `yaml:"webauthn"`
+	Notifier       NotifierConfig       `yaml:"notifier"`
+	NewDevice      NewDeviceConfig      `yaml:"new_device"`
+	Signup         SignupConfig         `yaml:"signup"`
+	Accounts       AccountsConfig       `yaml:"accounts"`
+	FxRates        FxRatesConfig        `yaml:"fx_rates"`
 }
 
 type ListenConfig struct {
 	Type   string `yaml:"type" env-default:"port"`
 	BindIP string `yaml:"bind_ip" env-default:"127.0.0.1"`
 	Port   string `yaml:"port" env-default:"8080"`
+	// адреса или подсети прокси, которым можно верить в X-Forwarded-For.
+	// Пусто - заголовок игнорируется, клиентом считается адрес соединения.
+	TrustedProxies []string `yaml:"trusted_proxies"`
 }
 
 type DatabaseConnConfig struct {
@@ -41,8 +60,148 @@ type BrokerConnConfig struct {
 }
 
 type JWTConfig struct {
-	AccessSecret  string `json:"access_secret"`
-	RefreshSecret string `json:"refresh_secret"`
+	AccessSecret  string `yaml:"access_secret" env:"JWT_ACCESS_SECRET"`
+	RefreshSecret string `yaml:"refresh_secret" env:"JWT_REFRESH_SECRET"`
+	// первый ключ списка подписывает новые токены, остальные только проверяют старые
+	AccessKeys  []JWTKey `yaml:"access_keys"`
+	RefreshKeys []JWTKey `yaml:"refresh_keys"`
+}
+
+type JWTKey struct {
+	Kid       string `yaml:"kid"`
+	Algorithm string `yaml:"algorithm" env-default:"HS256"`
+	Secret    string `yaml:"secret"`
+	// для RS256/EdDSA: ключ без private_key_file только проверяет подпись
+	PrivateKeyFile string `yaml:"private_key_file"`
+	PublicKeyFile  string `yaml:"public_key_file"`
+}
+
+type TotpConfig struct {
+	Issuer        string `yaml:"issuer" env-default:"project"`
+	RecoveryCodes int    `yaml:"recovery_codes" env-default:"10"`
+}
+
+type LoginLimitConfig struct {
+	MaxFailures     int           `yaml:"max_failures" env-default:"5"`
+	MaxIPFailures   int           `yaml:"max_ip_failures" env-default:"20"`
+	BaseDelay       time.Duration `yaml:"base_delay" env-default:"1s"`
+	FailureWindow   time.Duration `yaml:"failure_window" env-default:"15m"`
+	LockoutDuration time.Duration `yaml:"lockout_duration" env-default:"15m"`
+	UnlockTokenTTL  time.Duration `yaml:"unlock_token_ttl" env-default:"30m"`
+	// ссылка из письма для снятия блокировки, к ней дописывается токен
+	UnlockURL string `yaml:"unlock_url" env-default:"http://localhost:3000/unlock?token="`
+}
+
+type MailConfig struct {
+	// smtp или file
+	Driver    string `yaml:"driver" env-default:"file"`
+	From      string `yaml:"from" env-default:"no-reply@localhost"`
+	Host      string `yaml:"host"`
+	Port      string `yaml:"port" env-default:"587"`
+	User      string `yaml:"user"`
+	Password  string `yaml:"password" env:"MAIL_PASSWORD"`
+	OutboxDir string `yaml:"outbox_dir" env-default:"outbox"`
+}
+
+type PasswordResetConfig struct {
+	TokenTTL time.Duration `yaml:"token_ttl" env-default:"30m"`
+	// ссылка из письма, к ней дописывается токен
+	URL string `yaml:"url" env-default:"http://localhost:3000/reset-password?token="`
+}
+
+type PasswordPolicyConfig struct {
+	MinLength int `yaml:"min_length" env-default:"10"`
+	MaxLength int `yaml:"max_length" env-default:"128"`
+	// сколько классов символов из четырех (строчные, заглавные, цифры, прочие) обязательно
+	MinCharClasses int `yaml:"min_char_classes" env-default:"3"`
+	// файл со списком распространенных/утекших паролей, по одному на строку
+	BlocklistFile string `yaml:"blocklist_file"`
+}
+
+// PasswordHashConfig - параметры argon2id. При их изменении пароли
+// перехэшируются при следующем успешном входе.
+type PasswordHashConfig struct {
+	MemoryKiB   uint32 `yaml:"memory_kib" env-default:"65536"`
+	Iterations  uint32 `yaml:"iterations" env-default:"3"`
+	Parallelism uint8  `yaml:"parallelism" env-default:"2"`
+}
+
+type EmailVerifyConfig struct {
+	TokenTTL time.Duration `yaml:"token_ttl" env-default:"24h"`
+	URL      string        `yaml:"url" env-default:"http://localhost:3000/verify-email?token="`
+}
+
+// OidcConfig - вход через внешний OpenID Connect провайдер. Эндпоинты
+// провайдера читаются из <issuer>/.well-known/openid-configuration.
+type OidcConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret" env:"OIDC_CLIENT_SECRET"`
+	RedirectURL  string   `yaml:"redirect_url" env-default:"http://localhost:8080/v1/auth/oidc/callback"`
+	Scopes       []string `yaml:"scopes" env-default:"openid,email,profile"`
+	// сколько живет state между /oidc/start и /oidc/callback
+	StateTTL time.Duration `yaml:"state_ttl" env-default:"10m"`
+}
+
+// StepUpConfig - повторная проверка пароля или TOTP перед крупными операциями
+type StepUpConfig struct {
+	// транзакции на сумму больше порога требуют подтверждения, 0 отключает проверку.
+	// Порог задан в accounts.default_currency, суммы в других валютах пересчитываются.
+	TransactionThreshold float64       `yaml:"transaction_threshold" env-default:"10000"`
+	MaxAge               time.Duration `yaml:"max_age" env-default:"5m"`
+}
+
+type WebAuthnConfig struct {
+	// домен сайта, к которому привязываются passkey
+	RPID          string        `yaml:"rp_id" env-default:"localhost"`
+	RPDisplayName string        `yaml:"rp_display_name" env-default:"project"`
+	RPOrigins     []string      `yaml:"rp_origins" env-default:"http://localhost:3000"`
+	ChallengeTTL  time.Duration `yaml:"challenge_ttl" env-default:"5m"`
+}
+
+type NotifierConfig struct {
+	// email или webhook
+	Driver        string `yaml:"driver" env-default:"email"`
+	WebhookURL    string `yaml:"webhook_url"`
+	WebhookSecret string `yaml:"webhook_secret" env:"NOTIFIER_WEBHOOK_SECRET"`
+}
+
+// NewDeviceConfig - определение входа с нового устройства. Адреса сравниваются
+// по подсети, чтобы смена адреса у провайдера не считалась новым устройством.
+type NewDeviceConfig struct {
+	IPv4Prefix int           `yaml:"ipv4_prefix" env-default:"24"`
+	IPv6Prefix int           `yaml:"ipv6_prefix" env-default:"48"`
+	ReportTTL  time.Duration `yaml:"report_ttl" env-default:"168h"`
+	// ссылка "это был не я" на страницу подтверждения, к ней дописывается токен
+	ReportURL string `yaml:"report_url" env-default:"http://localhost:8080/v1/auth/device/report?token="`
+}
+
+// SignupConfig - защита регистрации: proof-of-work и лимит регистраций с одного IP
+type SignupConfig struct {
+	// число нулевых старших бит sha256(challenge:nonce), 0 отключает проверку
+	Difficulty   int           `yaml:"difficulty" env-default:"20"`
+	ChallengeTTL time.Duration `yaml:"challenge_ttl" env-default:"5m"`
+	MaxPerIP     int           `yaml:"max_per_ip" env-default:"5"`
+	QuotaWindow  time.Duration `yaml:"quota_window" env-default:"24h"`
+}
+
+type AccountsConfig struct {
+	// валюта счета, если клиент не указал ее при создании
+	DefaultCurrency string `yaml:"default_currency" env-default:"USD"`
+}
+
+// FxRatesConfig - курсы валют для пересчета в отчетах
+type FxRatesConfig struct {
+	// базовая валюта загружаемых курсов, у ECB это EUR
+	Base string `yaml:"base" env-default:"EUR"`
+	// файл ECB (eurofxref-hist.xml или .csv), пусто - импорт отключен
+	File          string `yaml:"file"`
+	ImportOnStart bool   `yaml:"import_on_start" env-default:"false"`
+	// насколько старым может быть курс: на выходные и праздники ECB курсы не публикует
+	MaxAge time.Duration `yaml:"max_age" env-default:"168h"`
+	// допустимое относительное отклонение курса из запроса перевода от курса fx_rates
+	TransferTolerance float64 `yaml:"transfer_tolerance" env-default:"0.01"`
 }
 
 var (
@@ -6,24 +6,46 @@ import (
 )
 
 var (
-	ErrUnauthorized   = NewAppError(nil, "please provide valid login details", "", "US-000008")
-	ErrBadRequest     = NewAppError(nil, "bad request data", "", "US-000007")
-	ErrNotFound       = NewAppError(nil, "not found", "", "US-000003")
-	ErrForbidden      = NewAppError(nil, "forbidden", "", "US-000001")
-	ErrRegistered     = NewAppError(nil, "user already registered", "", "US-000002")
-	ErrInvalidToken   = NewAppError(nil, "invalid jwt token", "", "US-000004")
-	ErrInvalid        = NewAppError(nil, "validate error", "", "US-000005")
-	ErrInternalServer = NewAppError(nil, "internal server error", "", "US-000006")
-	ErrExpiredRefresh = NewAppError(nil, "refresh token is expired", "", "US-000008")
-	ErrExpiredToken   = NewAppError(nil, "token is expired", "", "US-000009")
-	ErrExistsAccount  = NewAppError(nil, "account is exists", "", "US-000010")
+	ErrUnauthorized    = NewAppError(nil, "please provide valid login details", "", "US-000008")
+	ErrBadRequest      = NewAppError(nil, "bad request data", "", "US-000007")
+	ErrNotFound        = NewAppError(nil, "not found", "", "US-000003")
+	ErrForbidden       = NewAppError(nil, "forbidden", "", "US-000001")
+	ErrRegistered      = NewAppError(nil, "user already registered", "", "US-000002")
+	ErrInvalidToken    = NewAppError(nil, "invalid jwt token", "", "US-000004")
+	ErrInvalid         = NewAppError(nil, "validate error", "", "US-000005")
+	ErrInternalServer  = NewAppError(nil, "internal server error", "", "US-000006")
+	ErrExpiredRefresh  = NewAppError(nil, "refresh token is expired", "", "US-000008")
+	ErrExpiredToken    = NewAppError(nil, "token is expired", "", "US-000009")
+	ErrExistsAccount   = NewAppError(nil, "account is exists", "", "US-000010")
+	ErrTokenReused     = NewAppError(nil, "refresh token was already used", "", "US-000011")
+	ErrInvalidTotp     = NewAppError(nil, "invalid two-factor code", "", "US-000012")
+	ErrTotpEnabled     = NewAppError(nil, "two-factor authentication is already enabled", "", "US-000013")
+	ErrTotpDisabled    = NewAppError(nil, "two-factor authentication is not enabled", "", "US-000014")
+	ErrScope           = NewAppError(nil, "api key does not have the required scope", "", "US-000015")
+	ErrTooManyLogins   = NewAppError(nil, "too many login attempts, try again later", "", "US-000016")
+	ErrAccountLocked   = NewAppError(nil, "account is temporarily locked", "", "US-000017")
+	ErrUserDisabled    = NewAppError(nil, "user is disabled", "", "US-000018")
+	ErrWeakPassword    = NewAppError(nil, "password does not meet the password policy", "", "US-000019")
+	ErrEmailRegistered = NewAppError(nil, "email already registered", "", "US-000020")
+	ErrEmailUnverified = NewAppError(nil, "email address is not verified", "", "US-000021")
+	ErrStepUpRequired  = NewAppError(nil, "re-authentication is required for this operation", "", "US-000022")
+	ErrInvalidProof    = NewAppError(nil, "registration challenge is missing or not solved", "", "US-000023")
+	ErrTooManySignups  = NewAppError(nil, "too many registrations from this address, try again later", "", "US-000024")
+	ErrVersionConflict = NewAppError(nil, "resource was modified by another request", "", "US-000025")
+	ErrAccountClosed   = NewAppError(nil, "account is closed", "", "US-000026")
+	ErrAccountNotEmpty = NewAppError(nil, "account balance is not zero, specify an account to transfer it to", "", "US-000027")
+	ErrInvalidCurrency = NewAppError(nil, "unknown ISO 4217 currency code", "", "US-000028")
+	ErrWrongCurrency   = NewAppError(nil, "currency does not match the account currency", "", "US-000029")
+	ErrRateNotFound    = NewAppError(nil, "no exchange rate for the currency on this date", "", "US-000030")
+	ErrRateMismatch    = NewAppError(nil, "exchange rate differs too much from the reference rate", "", "US-000031")
 )
 
 type AppError struct {
-	Err              error  `json:"-"`
-	Message          string `json:"message,omitempty"`
-	DeveloperMessage string `json:"developer_message,omitempty"`
-	Code             string `json:"code,omitempty"`
+	Err              error       `json:"-"`
+	Message          string      `json:"message,omitempty"`
+	DeveloperMessage string      `json:"developer_message,omitempty"`
+	Code             string      `json:"code,omitempty"`
+	Details          interface{} `json:"details,omitempty"`
 }
 
 func (e *AppError) Error() string {
@@ -34,6 +56,17 @@ func (e *AppError) Unwrap() error {
 	return e.Err
 }
 
+// Is сравнивает ошибки по коду, чтобы errors.Is находил и копии из WithDetails.
+// Сообщение тоже сравнивается: у ErrUnauthorized и ErrExpiredRefresh один код.
+func (e *AppError) Is(target error) bool {
+	t, ok := target.(*AppError)
+	if !ok {
+		return false
+	}
+
+	return e.Code == t.Code && e.Message == t.Message
+}
+
 func (e *AppError) Marshal() []byte {
 	marshal, err := json.MarshalIndent(e, "", "    ")
 	if err != nil {
@@ -43,6 +76,14 @@ func (e *AppError) Marshal() []byte {
 	return marshal
 }
 
+// WithDetails возвращает копию ошибки с подробностями для клиента,
+// общие переменные ошибок при этом не меняются
+func (e *AppError) WithDetails(details interface{}) *AppError {
+	appErr := *e
+	appErr.Details = details
+	return &appErr
+}
+
 func NewAppError(err error, message, developerMessage, code string) *AppError {
 	return &AppError{
 		Err:              err,
@@ -0,0 +1,27 @@
+package apperror
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestIsMatchesCopiesWithDetails(t *testing.T) {
+	err := ErrVersionConflict.WithDetails(map[string]int{"version": 3})
+
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Error("errors.Is does not match a copy from WithDetails")
+	}
+	if !errors.Is(fmt.Errorf("update account: %w", err), ErrVersionConflict) {
+		t.Error("errors.Is does not match a wrapped copy")
+	}
+	if errors.Is(err, ErrNotFound) {
+		t.Error("errors.Is matches a different error")
+	}
+	if !errors.Is(ErrRateNotFound.WithDetails(map[string]string{"currency": "JPY"}), ErrRateNotFound) {
+		t.Error("errors.Is does not match ErrRateNotFound with details")
+	}
+	if errors.Is(ErrExpiredRefresh, ErrUnauthorized) {
+		t.Error("errors with the same code but different messages must not match")
+	}
+}
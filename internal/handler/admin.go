@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+)
+
+func (h *Handler) AdminGetUsers(c *gin.Context) {
+	var filter models.UserFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		logger.Error.Println(err)
+		c.JSON(400, apperror.ErrBadRequest)
+		return
+	}
+
+	users, err := h.Service.SearchUsers(&filter)
+	if err != nil {
+		logger.Error.Println(err)
+		c.JSON(500, apperror.ErrInternalServer)
+		return
+	}
+
+	c.JSON(200, users)
+}
+
+func (h *Handler) AdminGetUser(c *gin.Context) {
+	u, err := h.Service.GetUser(c.Param("id"))
+	if err != nil {
+		abortWithError(c, 404, err)
+		return
+	}
+
+	c.JSON(200, u.Info())
+}
+
+func (h *Handler) AdminGetUserAccounts(c *gin.Context) {
+	accounts, err := h.Service.GetAccounts(c.Param("id"), true)
+	if err != nil {
+		logger.Error.Println(err)
+		c.JSON(500, apperror.ErrInternalServer)
+		return
+	}
+
+	c.JSON(200, accounts)
+}
+
+func (h *Handler) AdminGetAccount(c *gin.Context) {
+	account, err := h.Service.GetAccountInfoById(c.Param("id"))
+	if err != nil {
+		logger.Error.Println(err)
+		c.JSON(500, apperror.ErrInternalServer)
+		return
+	}
+	if account == nil || account.ID == "" {
+		c.JSON(404, apperror.ErrNotFound)
+		return
+	}
+
+	c.JSON(200, account)
+}
+
+func (h *Handler) AdminUnlockUser(c *gin.Context) {
+	err := h.Service.UnlockUser(c.Param("id"))
+	if err != nil {
+		abortWithError(c, 404, err)
+		return
+	}
+
+	c.JSON(200, "user was unlocked")
+}
+
+func (h *Handler) AdminDisableUser(c *gin.Context) {
+	if c.Param("id") == c.GetString("user_id") {
+		c.JSON(400, apperror.ErrBadRequest)
+		return
+	}
+
+	err := h.Service.SetUserDisabled(c.Param("id"), true)
+	if err != nil {
+		abortWithError(c, 404, err)
+		return
+	}
+
+	c.JSON(200, "user was disabled")
+}
+
+func (h *Handler) AdminEnableUser(c *gin.Context) {
+	err := h.Service.SetUserDisabled(c.Param("id"), false)
+	if err != nil {
+		abortWithError(c, 404, err)
+		return
+	}
+
+	c.JSON(200, "user was enabled")
+}
+
+func (h *Handler) AdminSetRole(c *gin.Context) {
+	var req *models.RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error.Println(err)
+		c.JSON(400, apperror.ErrBadRequest)
+		return
+	}
+	if c.Param("id") == c.GetString("user_id") {
+		c.JSON(400, apperror.ErrBadRequest)
+		return
+	}
+
+	err := h.Service.SetUserRole(c.Param("id"), req.Role)
+	if err != nil {
+		abortWithError(c, 400, err)
+		return
+	}
+
+	c.JSON(200, "role was changed")
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+)
+
+func (h *Handler) CreateApiKey(c *gin.Context) {
+	var req *models.ApiKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error.Println(err)
+		c.JSON(400, apperror.ErrBadRequest)
+		return
+	}
+
+	rawKey, key, err := h.Service.CreateApiKey(c.GetString("user_id"), req)
+	if err != nil {
+		abortWithError(c, 400, err)
+		return
+	}
+
+	c.JSON(201, map[string]interface{}{
+		"key":     rawKey,
+		"api_key": key,
+	})
+}
+
+func (h *Handler) GetApiKeys(c *gin.Context) {
+	keys, err := h.Service.GetApiKeys(c.GetString("user_id"))
+	if err != nil {
+		logger.Error.Println(err)
+		c.JSON(500, apperror.ErrInternalServer)
+		return
+	}
+
+	c.JSON(200, keys)
+}
+
+func (h *Handler) RevokeApiKey(c *gin.Context) {
+	err := h.Service.RevokeApiKey(c.GetString("user_id"), c.Param("id"))
+	if err != nil {
+		abortWithError(c, 404, err)
+		return
+	}
+
+	c.JSON(200, "api key was revoked")
+}
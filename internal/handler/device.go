@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+	"html/template"
+	"strings"
+)
+
+// reportDevicePage - страница подтверждения для ссылки из письма. Сканеры почты
+// и предзагрузка ссылок открывают GET сами, поэтому сессия отзывается только POST формой.
+var reportDevicePage = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign-in from a new device</title></head>
+<body>
+{{if .Token}}
+<p>Was this sign-in not you? The new device will be signed out.</p>
+<form method="post" action="/v1/auth/device/report">
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit">It wasn't me, sign the device out</button>
+</form>
+{{else}}
+<p>{{.Message}}</p>
+{{end}}
+</body>
+</html>
+`))
+
+type reportDeviceView struct {
+	Token   string
+	Message string
+}
+
+// ReportDevicePage открывается по ссылке "это был не я" и ничего не меняет
+func (h *Handler) ReportDevicePage(c *gin.Context) {
+	h.renderReportDevice(c, 200, reportDeviceView{Token: c.Query("token"), Message: "The link is invalid."})
+}
+
+// ReportDevice завершает сессию нового устройства. Токен принимается из формы
+// страницы подтверждения или из JSON {"token": "..."}.
+func (h *Handler) ReportDevice(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" form:"token"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		logger.Error.Println(err)
+	}
+	isForm := !strings.HasPrefix(c.ContentType(), "application/json")
+
+	userID, err := h.Service.ReportDevice(req.Token)
+	if err != nil {
+		if isForm {
+			logger.Error.Println(err)
+			h.renderReportDevice(c, 400, reportDeviceView{Message: "The link is invalid or was already used."})
+			return
+		}
+		abortWithError(c, 400, err)
+		return
+	}
+	h.securityEvent(c, models.EventDeviceReported, userID, models.OutcomeSuccess, nil)
+
+	if isForm {
+		h.renderReportDevice(c, 200, reportDeviceView{Message: "The device was signed out, please change your password."})
+		return
+	}
+	c.JSON(200, "the device was signed out, please change your password")
+}
+
+func (h *Handler) renderReportDevice(c *gin.Context, status int, view reportDeviceView) {
+	var page bytes.Buffer
+	if err := reportDevicePage.Execute(&page, view); err != nil {
+		abortWithError(c, 500, err)
+		return
+	}
+
+	// токен в адресе страницы не должен уходить в Referer, кэш и чужие фреймы
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("X-Frame-Options", "DENY")
+	c.Data(status, "text/html; charset=utf-8", page.Bytes())
+}
+
+func (h *Handler) GetKnownDevices(c *gin.Context) {
+	devices, err := h.Service.GetKnownDevices(c.GetString("user_id"))
+	if err != nil {
+		abortWithError(c, 500, err)
+		return
+	}
+
+	c.JSON(200, devices)
+}
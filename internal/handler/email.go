@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+)
+
+func (h *Handler) VerifyEmail(c *gin.Context) {
+	var req *models.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error.Println(err)
+		c.JSON(400, apperror.ErrBadRequest)
+		return
+	}
+
+	err := h.Service.VerifyEmail(req.Token)
+	if err != nil {
+		abortWithError(c, 400, err)
+		return
+	}
+
+	c.JSON(200, "email was verified")
+}
+
+func (h *Handler) ResendEmailVerification(c *gin.Context) {
+	err := h.Service.SendEmailVerification(c.GetString("user_id"))
+	if err != nil {
+		abortWithError(c, 400, err)
+		return
+	}
+
+	c.JSON(200, "verification email was sent")
+}
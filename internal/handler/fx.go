@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/pkg/currency"
+	"github.com/k4zb3k/project/pkg/logger"
+	"time"
+)
+
+// GetTotals возвращает доходы и расходы по всем счетам пользователя в одной валюте.
+// Параметры: currency (по умолчанию валюта счетов из конфигурации), date_from, date_to (дд-мм-гггг).
+func (h *Handler) GetTotals(c *gin.Context) {
+	code := currency.Normalize(c.Query("currency"))
+	if code == "" {
+		code = h.Service.Config.Accounts.DefaultCurrency
+	}
+	if !currency.IsValid(code) {
+		c.JSON(400, apperror.ErrInvalidCurrency)
+		return
+	}
+
+	var from, to time.Time
+	var err error
+	if dateFrom := c.Query("date_from"); dateFrom != "" {
+		from, err = time.Parse("02-01-2006", dateFrom)
+		if err != nil {
+			logger.Error.Println(err)
+			c.JSON(400, apperror.ErrBadRequest)
+			return
+		}
+	}
+	if dateTo := c.Query("date_to"); dateTo != "" {
+		to, err = time.Parse("02-01-2006", dateTo)
+		if err != nil {
+			logger.Error.Println(err)
+			c.JSON(400, apperror.ErrBadRequest)
+			return
+		}
+		// дата окончания входит в период целиком
+		to = to.Add(24*time.Hour - time.Nanosecond)
+	}
+
+	totals, err := h.Service.GetTotals(c.GetString("user_id"), code, from, to)
+	if err != nil {
+		abortWithError(c, 422, err)
+		return
+	}
+	totals.DateFrom = c.Query("date_from")
+	totals.DateTo = c.Query("date_to")
+
+	c.JSON(200, totals)
+}
+
+// AdminImportRates загружает курсы ECB из файла, указанного в fx_rates.file
+func (h *Handler) AdminImportRates(c *gin.Context) {
+	result, err := h.Service.ImportRatesFile()
+	if err != nil {
+		abortWithError(c, 400, err)
+		return
+	}
+
+	c.JSON(200, result)
+}
@@ -2,12 +2,15 @@ package handler
 
 import (
 	"bytes"
-	"fmt"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/k4zb3k/project/internal/apperror"
 	"github.com/k4zb3k/project/internal/models"
 	"github.com/k4zb3k/project/internal/service"
+	"github.com/k4zb3k/project/pkg/currency"
 	"github.com/k4zb3k/project/pkg/logger"
+	"math"
+	"strconv"
 	"time"
 )
 
@@ -26,25 +29,89 @@ func NewHandler(engine *gin.Engine, service *service.Service) *Handler {
 // ==============================================
 
 func (h *Handler) InitRoutes() {
+	h.Engine.GET("/.well-known/jwks.json", h.JWKS)
+
 	generalRout := h.Engine.Group("v1")
 
 	auth := generalRout.Group("/auth")
 	{
 		auth.POST("/create", h.CreateUser)
+		auth.POST("/create/challenge", h.CreateSignupChallenge)
 		auth.POST("/login", h.Login)
+		auth.POST("/login/totp", h.LoginTotp)
+		auth.POST("/unlock", h.Unlock)
+		auth.POST("/unlock/email", h.RequestUnlockEmail)
+		auth.POST("/password/forgot", h.ForgotPassword)
+		auth.POST("/password/reset", h.ResetPassword)
+		auth.POST("/email/verify", h.VerifyEmail)
+		auth.GET("/oidc/start", h.OidcStart)
+		auth.GET("/oidc/callback", h.OidcCallback)
+		auth.POST("/passkey/begin", h.BeginPasskeyLogin)
+		auth.POST("/passkey/finish", h.FinishPasskeyLogin)
+		auth.GET("/device/report", h.ReportDevicePage)
+		auth.POST("/device/report", h.ReportDevice)
+		auth.POST("/refresh", h.Refresh)
+		auth.POST("/logout", h.TokenAuthMiddleware(), h.RequireSession(), h.Logout)
+		auth.POST("/logout-all", h.TokenAuthMiddleware(), h.RequireSession(), h.LogoutAll)
 	}
 
 	api := generalRout.Group("/api")
 	api.Use(h.TokenAuthMiddleware())
 	{
-		api.POST("/account", h.CreateAccount)
-		api.GET("/account", h.GetAccounts)
-		api.GET("/account/:id", h.GetAccountById)
-		api.PUT("/account", h.UpdateAccount) // todo // do not know what to do
-		api.POST("/transaction", h.CreateTransaction)
-		api.GET("/transaction", h.GetTransactions)
-		api.GET("/transaction/:id", h.GetTransactionById)
-		api.POST("/reports", h.GetReports)
+		api.POST("/account", h.RequireScope(models.ScopeAccountsWrite), h.RequireVerifiedEmail(), h.CreateAccount)
+		api.GET("/account", h.RequireScope(models.ScopeAccountsRead), h.GetAccounts)
+		api.GET("/account/:id", h.RequireScope(models.ScopeAccountsRead), h.GetAccountById)
+		api.PATCH("/account/:id", h.RequireScope(models.ScopeAccountsWrite), h.RequireVerifiedEmail(), h.UpdateAccount)
+		api.POST("/account/:id/close", h.RequireScope(models.ScopeAccountsWrite), h.RequireVerifiedEmail(), h.CloseAccount)
+		api.POST("/account/:id/restore", h.RequireScope(models.ScopeAccountsWrite), h.RequireVerifiedEmail(), h.RestoreAccount)
+		api.POST("/transaction", h.RequireScope(models.ScopeTransactionsWrite), h.RequireVerifiedEmail(), h.CreateTransaction)
+		api.GET("/transaction", h.RequireScope(models.ScopeTransactionsRead), h.GetTransactions)
+		api.GET("/transaction/:id", h.RequireScope(models.ScopeTransactionsRead), h.GetTransactionById)
+		api.POST("/transfer", h.RequireScope(models.ScopeTransactionsWrite), h.RequireVerifiedEmail(), h.Transfer)
+		api.POST("/reports", h.RequireScope(models.ScopeReportsRead), h.GetReports)
+		api.GET("/totals", h.RequireScope(models.ScopeReportsRead), h.GetTotals)
+	}
+
+	session := api.Group("")
+	session.Use(h.RequireSession())
+	{
+		session.POST("/2fa/totp/enroll", h.EnrollTotp)
+		session.POST("/2fa/totp/confirm", h.ConfirmTotp)
+		session.POST("/2fa/totp/disable", h.DisableTotp)
+		session.POST("/keys", h.RequireVerifiedEmail(), h.CreateApiKey)
+		session.GET("/keys", h.GetApiKeys)
+		session.DELETE("/keys/:id", h.RevokeApiKey)
+		session.GET("/me", h.GetMe)
+		session.PATCH("/me", h.UpdateMe)
+		session.POST("/me/password", h.ChangePassword)
+		session.POST("/me/email/resend", h.ResendEmailVerification)
+		session.POST("/step-up", h.StepUp)
+		session.POST("/step-up/passkey/begin", h.BeginStepUpPasskey)
+		session.POST("/step-up/passkey/finish", h.FinishStepUpPasskey)
+		session.POST("/passkeys/register/begin", h.BeginPasskeyRegistration)
+		session.POST("/passkeys/register/finish", h.FinishPasskeyRegistration)
+		session.GET("/passkeys", h.GetPasskeys)
+		session.DELETE("/passkeys/:id", h.DeletePasskey)
+		session.DELETE("/me", h.DeleteMe)
+		session.GET("/sessions", h.GetSessions)
+		session.GET("/me/devices", h.GetKnownDevices)
+		session.GET("/me/security-events", h.GetMySecurityEvents)
+		session.DELETE("/sessions/:id", h.RevokeSession)
+	}
+
+	admin := generalRout.Group("/admin")
+	admin.Use(h.TokenAuthMiddleware(), h.RequireSession(), h.RequireRole(models.RoleSupport, models.RoleAdmin))
+	{
+		admin.GET("/users", h.AdminGetUsers)
+		admin.GET("/users/:id", h.AdminGetUser)
+		admin.GET("/users/:id/accounts", h.AdminGetUserAccounts)
+		admin.POST("/users/:id/unlock", h.AdminUnlockUser)
+		admin.GET("/accounts/:id", h.AdminGetAccount)
+		admin.GET("/security-events", h.AdminGetSecurityEvents)
+		admin.POST("/users/:id/disable", h.RequireRole(models.RoleAdmin), h.AdminDisableUser)
+		admin.POST("/users/:id/enable", h.RequireRole(models.RoleAdmin), h.AdminEnableUser)
+		admin.PUT("/users/:id/role", h.RequireRole(models.RoleAdmin), h.AdminSetRole)
+		admin.POST("/fx-rates/import", h.RequireRole(models.RoleAdmin), h.AdminImportRates)
 	}
 }
 
@@ -59,10 +126,39 @@ func (h *Handler) CreateUser(c *gin.Context) {
 	}
 
 	ctx := c.Request.Context()
+	ip := c.ClientIP()
+
+	retryAfter, err := h.Service.ReserveSignup(ip)
+	if err != nil {
+		h.securityEvent(c, models.EventSignup, "", models.OutcomeDenied, models.EventDetails{
+			"username": u.Username,
+			"reason":   "quota",
+		})
+		abortWithRetryAfter(c, retryAfter, err)
+		return
+	}
+	// место в квоте занято заранее и возвращается, если пользователь не создан
+	created := false
+	defer func() {
+		if !created {
+			h.Service.ReleaseSignup(ip)
+		}
+	}()
+
+	// решение proof-of-work задачи из POST /v1/auth/create/challenge
+	err = h.Service.CheckSignupProof(c.GetHeader("X-Pow-Challenge"), c.GetHeader("X-Pow-Nonce"))
+	if err != nil {
+		h.securityEvent(c, models.EventSignup, "", models.OutcomeDenied, models.EventDetails{
+			"username": u.Username,
+			"reason":   "proof_of_work",
+		})
+		abortWithError(c, 400, err)
+		return
+	}
 
 	err = h.Service.ValidateUser(u)
 	if err != nil {
-		c.JSON(400, apperror.ErrInvalid)
+		abortWithError(c, 400, err)
 		return
 	}
 
@@ -73,15 +169,36 @@ func (h *Handler) CreateUser(c *gin.Context) {
 		return
 	}
 	if existsUser {
+		h.securityEvent(c, models.EventSignup, "", models.OutcomeFailure, models.EventDetails{
+			"username": u.Username,
+			"reason":   "username_taken",
+		})
 		c.JSON(400, apperror.ErrRegistered)
 		return
 	}
 
-	userID, err := h.Service.CreateUser(ctx, u)
+	existsEmail, err := h.Service.ExistsEmail(u.Email)
 	if err != nil {
+		logger.Error.Println(err)
 		c.JSON(500, apperror.ErrInternalServer)
 		return
 	}
+	if existsEmail {
+		h.securityEvent(c, models.EventSignup, "", models.OutcomeFailure, models.EventDetails{
+			"username": u.Username,
+			"reason":   "email_taken",
+		})
+		c.JSON(400, apperror.ErrEmailRegistered)
+		return
+	}
+
+	userID, err := h.Service.CreateUser(ctx, u)
+	if err != nil {
+		abortWithError(c, 400, err)
+		return
+	}
+	created = true
+	h.securityEvent(c, models.EventSignup, userID, models.OutcomeSuccess, nil)
 
 	c.JSON(201, map[string]string{
 		"user_id": userID,
@@ -96,27 +213,171 @@ func (h *Handler) Login(c *gin.Context) {
 		return
 	}
 
+	ip := c.ClientIP()
+	retryAfter, err := h.Service.CheckLoginAllowed(u.Username, ip)
+	if err != nil {
+		h.securityEvent(c, models.EventLogin, "", models.OutcomeDenied, models.EventDetails{
+			"method":   "password",
+			"username": u.Username,
+			"reason":   "locked",
+		})
+		abortWithRetryAfter(c, retryAfter, err)
+		return
+	}
+
 	userID, err := h.Service.CheckUser(u)
 	if err != nil {
 		logger.Error.Println(err)
+		h.securityEvent(c, models.EventLogin, "", models.OutcomeFailure, models.EventDetails{
+			"method":   "password",
+			"username": u.Username,
+			"reason":   "invalid_credentials",
+		})
+		retryAfter, lockErr := h.Service.RegisterLoginFailure(u.Username, ip)
+		if lockErr != nil {
+			if errors.Is(lockErr, apperror.ErrAccountLocked) {
+				h.securityEvent(c, models.EventLockout, "", models.OutcomeDenied, models.EventDetails{
+					"username": u.Username,
+					"duration": retryAfter.String(),
+				})
+			}
+			abortWithRetryAfter(c, retryAfter, lockErr)
+			return
+		}
 		c.JSON(401, apperror.ErrUnauthorized)
 		return
 	}
 
-	ts, err := h.Service.CreateToken(userID)
+	h.completeLogin(c, userID, "password")
+}
+
+// completeLogin выдает токены после проверки первого фактора
+// или challenge, если у пользователя включена 2FA
+func (h *Handler) completeLogin(c *gin.Context, userID, method string) {
+	user, err := h.Service.GetUserInfoById(userID)
 	if err != nil {
 		logger.Error.Println(err)
 		c.JSON(500, apperror.ErrInternalServer)
 		return
 	}
 
-	saveErr := h.Service.CreateAuth(userID, ts)
-	if saveErr != nil {
+	if user.DisabledAt != nil {
+		h.securityEvent(c, models.EventLogin, userID, models.OutcomeDenied, models.EventDetails{
+			"method": method,
+			"reason": "user_disabled",
+		})
+		c.JSON(403, apperror.ErrUserDisabled)
+		return
+	}
+
+	// при включенной 2FA токены выдаются только после ввода кода, и только тогда
+	// сбрасываются счетчики неудачных попыток (см. CompleteLoginChallenge)
+	if user.TotpEnabled {
+		challenge, err := h.Service.CreateLoginChallenge(userID)
+		if err != nil {
+			logger.Error.Println(err)
+			c.JSON(500, apperror.ErrInternalServer)
+			return
+		}
+
+		c.JSON(200, map[string]interface{}{
+			"mfa_required":    true,
+			"challenge_token": challenge,
+		})
+		return
+	}
+	h.Service.ResetLoginFailures(user.Username)
+
+	h.issueTokens(c, userID, method)
+}
+
+// Unlock досрочно снимает блокировку входа по TOTP коду или коду восстановления
+func (h *Handler) Unlock(c *gin.Context) {
+	var req *models.UnlockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error.Println(err)
+		c.JSON(400, apperror.ErrBadRequest)
+		return
+	}
+
+	err := h.Service.UnlockAccount(req)
+	if err != nil {
+		abortWithError(c, 401, err)
+		return
+	}
+
+	c.JSON(200, "account was unlocked")
+}
+
+// RequestUnlockEmail отправляет ссылку для снятия блокировки, если у пользователя подтверждена почта
+func (h *Handler) RequestUnlockEmail(c *gin.Context) {
+	var req *models.UnlockEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Username == "" {
+		logger.Error.Println(err)
+		c.JSON(400, apperror.ErrBadRequest)
+		return
+	}
+
+	err := h.Service.RequestUnlockEmail(req.Username)
+	if err != nil {
+		abortWithError(c, 429, err)
+		return
+	}
+
+	c.JSON(200, "if the user has a verified email, an unlock link was sent to it")
+}
+
+func (h *Handler) issueTokens(c *gin.Context, userID, method string) {
+	ts, err := h.Service.CreateToken(userID, "")
+	if err != nil {
+		abortWithError(c, 403, err)
+		return
+	}
+
+	err = h.Service.CreateAuth(userID, ts, clientInfo(c))
+	if err != nil {
 		logger.Error.Println(err)
 		c.JSON(500, apperror.ErrInternalServer)
 		return
 	}
 
+	h.securityEvent(c, models.EventLogin, userID, models.OutcomeSuccess, models.EventDetails{
+		"method":     method,
+		"session_id": ts.SessionID,
+	})
+
+	if h.Service.CheckLoginDevice(userID, ts.SessionID, clientInfo(c)) {
+		h.securityEvent(c, models.EventNewDevice, userID, models.OutcomeSuccess, models.EventDetails{"session_id": ts.SessionID})
+	}
+
+	tokens := map[string]string{
+		"access_token":  ts.AccessToken,
+		"refresh_token": ts.RefreshToken,
+	}
+
+	c.JSON(200, tokens)
+}
+
+func (h *Handler) Refresh(c *gin.Context) {
+	var req *models.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error.Println(err)
+		c.JSON(400, apperror.ErrBadRequest)
+		return
+	}
+
+	ts, err := h.Service.RefreshToken(req.RefreshToken, clientInfo(c))
+	if err != nil {
+		reason := "invalid_token"
+		if errors.Is(err, apperror.ErrTokenReused) {
+			reason = "token_reused"
+		}
+		h.securityEvent(c, models.EventTokenRefresh, "", models.OutcomeFailure, models.EventDetails{"reason": reason})
+		abortWithError(c, 401, err)
+		return
+	}
+	h.securityEvent(c, models.EventTokenRefresh, ts.UserID, models.OutcomeSuccess, models.EventDetails{"session_id": ts.SessionID})
+
 	tokens := map[string]string{
 		"access_token":  ts.AccessToken,
 		"refresh_token": ts.RefreshToken,
@@ -125,6 +386,43 @@ func (h *Handler) Login(c *gin.Context) {
 	c.JSON(200, tokens)
 }
 
+func (h *Handler) Logout(c *gin.Context) {
+	ad := &models.AccessDetails{
+		AccessUuid: c.GetString("access_uuid"),
+		UserId:     c.GetString("user_id"),
+		SessionId:  c.GetString("session_id"),
+	}
+
+	err := h.Service.DeleteAuth(ad)
+	if err != nil {
+		logger.Error.Println(err)
+		c.JSON(500, apperror.ErrInternalServer)
+		return
+	}
+
+	h.securityEvent(c, models.EventLogout, ad.UserId, models.OutcomeSuccess, models.EventDetails{"session_id": ad.SessionId})
+
+	c.JSON(200, "successfully logged out")
+}
+
+func (h *Handler) LogoutAll(c *gin.Context) {
+	err := h.Service.RevokeAllSessions(c.GetString("user_id"))
+	if err != nil {
+		logger.Error.Println(err)
+		c.JSON(500, apperror.ErrInternalServer)
+		return
+	}
+
+	h.securityEvent(c, models.EventLogoutAll, c.GetString("user_id"), models.OutcomeSuccess, nil)
+
+	c.JSON(200, "all sessions were logged out")
+}
+
+func (h *Handler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(200, h.Service.AccessKeys.JWKS())
+}
+
 func (h *Handler) CreateAccount(c *gin.Context) {
 	var acc *models.Account
 
@@ -159,8 +457,7 @@ func (h *Handler) CreateAccount(c *gin.Context) {
 	// регистрация нового счета пользователя
 	err = h.Service.CreateAccount(acc)
 	if err != nil {
-		logger.Error.Println(err)
-		c.JSON(500, apperror.ErrInternalServer)
+		abortWithError(c, 400, err)
 		return
 	}
 
@@ -176,7 +473,10 @@ func (h *Handler) GetAccounts(c *gin.Context) {
 	}
 	userID := userId.(string)
 
-	accounts, err := h.Service.GetAccounts(userID)
+	// закрытые счета показываются только по запросу
+	includeClosed, _ := strconv.ParseBool(c.Query("include_closed"))
+
+	accounts, err := h.Service.GetAccounts(userID, includeClosed)
 	if err != nil {
 		logger.Error.Println(err)
 		c.JSON(500, apperror.ErrInternalServer)
@@ -208,33 +508,63 @@ func (h *Handler) GetAccountById(c *gin.Context) {
 }
 
 func (h *Handler) UpdateAccount(c *gin.Context) {
-	var acc *models.Account
+	var req *models.AccountUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error.Println(err)
+		c.JSON(400, apperror.ErrBadRequest)
+		return
+	}
 
-	userId, ok := c.Get("user_id")
-	if !ok {
-		logger.Error.Println("can not get user ID from token")
-		c.AbortWithStatus(500) //todo
+	account, err := h.Service.UpdateAccount(c.GetString("user_id"), c.Param("id"), req)
+	if err != nil {
+		var status int
+		switch {
+		case errors.Is(err, apperror.ErrVersionConflict):
+			status = 409
+		case errors.Is(err, apperror.ErrNotFound):
+			status = 404
+		default:
+			status = 400
+		}
+		abortWithError(c, status, err)
 		return
 	}
-	userID := userId.(string)
 
-	acc.UserID = userID
+	c.JSON(200, account)
+}
+
+// CloseAccount закрывает счет. Тело запроса необязательно, пока баланс нулевой.
+func (h *Handler) CloseAccount(c *gin.Context) {
+	var req models.CloseAccountRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			logger.Error.Println(err)
+			c.JSON(400, apperror.ErrBadRequest)
+			return
+		}
+	}
 
-	err := c.ShouldBindJSON(&acc)
+	err := h.Service.CloseAccount(c.GetString("user_id"), c.Param("id"), req.TransferTo)
 	if err != nil {
-		logger.Error.Println(err)
-		c.JSON(400, apperror.ErrBadRequest)
+		status := 400
+		if errors.Is(err, apperror.ErrNotFound) {
+			status = 404
+		}
+		abortWithError(c, status, err)
 		return
 	}
 
-	err = h.Service.UpdateAccount(acc)
+	c.JSON(200, "account was closed")
+}
+
+func (h *Handler) RestoreAccount(c *gin.Context) {
+	err := h.Service.RestoreAccount(c.GetString("user_id"), c.Param("id"))
 	if err != nil {
-		logger.Error.Println(err)
-		c.JSON(500, apperror.ErrInternalServer)
+		abortWithError(c, 404, err)
 		return
 	}
 
-	c.JSON(200, "account was Updated")
+	c.JSON(200, "account was restored")
 }
 
 func (h *Handler) CreateTransaction(c *gin.Context) {
@@ -260,6 +590,12 @@ func (h *Handler) CreateTransaction(c *gin.Context) {
 		c.JSON(400, apperror.ErrBadRequest)
 		return
 	}
+	// направление задает тип, отрицательная сумма обходила бы и смысл типа, и step-up
+	if tr.Amount <= 0 {
+		logger.Error.Println("transaction amount must be positive")
+		c.JSON(400, apperror.ErrBadRequest)
+		return
+	}
 
 	account, err := h.Service.GetAccountById(userID, tr.AccountID)
 	if err != nil {
@@ -272,24 +608,28 @@ func (h *Handler) CreateTransaction(c *gin.Context) {
 		c.JSON(400, apperror.ErrBadRequest)
 		return
 	}
+	if account.DeletedAt.Valid {
+		c.JSON(400, apperror.ErrAccountClosed)
+		return
+	}
 
-	err = h.Service.CreateTransaction(tr)
+	err = h.Service.CheckTransactionCurrency(&account, tr)
 	if err != nil {
-		logger.Error.Println(err)
-		c.JSON(500, apperror.ErrInternalServer)
+		abortWithError(c, 400, err)
 		return
 	}
 
-	if tr.Type == "expense" {
-		account.Balance -= tr.Amount
-	} else if tr.Type == "income" {
-		account.Balance += tr.Amount
+	// крупные транзакции требуют недавнего подтверждения, порог задан в валюте по умолчанию
+	err = h.Service.CheckTransactionStepUp(userID, c.GetString("session_id"), tr.Amount, tr.Currency)
+	if err != nil {
+		c.Header("WWW-Authenticate", `Bearer error="insufficient_user_authentication"`)
+		abortWithError(c, 401, err)
+		return
 	}
 
-	err = h.Service.UpdateAccount(&account)
+	err = h.Service.CreateTransaction(tr)
 	if err != nil {
-		logger.Error.Println(err)
-		c.JSON(500, apperror.ErrInternalServer)
+		abortWithError(c, 400, err)
 		return
 	}
 
@@ -307,7 +647,7 @@ func (h *Handler) GetTransactions(c *gin.Context) {
 	}
 	userID := userId.(string)
 
-	accounts, err := h.Service.GetAccounts(userID)
+	accounts, err := h.Service.GetAccounts(userID, true)
 	if err != nil {
 		logger.Error.Println(err)
 		c.JSON(500, apperror.ErrInternalServer)
@@ -379,11 +719,16 @@ func (h *Handler) GetReports(c *gin.Context) {
 		c.JSON(500, apperror.ErrInternalServer)
 		return
 	}
-	if report.Type != "" && report.Type != "expense" && report.Type != "income" {
+	if report.Type != "" && report.Type != "expense" && report.Type != "income" && report.Type != models.TransactionTransfer {
 		logger.Error.Println("incorrect transaction type")
 		c.JSON(400, apperror.ErrBadRequest)
 		return
 	}
+	report.Currency = currency.Normalize(report.Currency)
+	if report.Currency != "" && !currency.IsValid(report.Currency) {
+		c.JSON(400, apperror.ErrInvalidCurrency)
+		return
+	}
 
 	//if report == (&models.Report{}) {
 	//	accounts, err := h.Service.GetAccounts(userID)
@@ -424,12 +769,10 @@ func (h *Handler) GetReports(c *gin.Context) {
 	report.From = from
 	report.To = to
 
-	fmt.Println(report)
-
 	reports, err := h.Service.GetReports(userID, report)
 	if err != nil {
-		logger.Error.Println(err)
-		c.JSON(500, apperror.ErrInternalServer)
+		// курса на дату операции может не оказаться в fx_rates
+		abortWithError(c, 422, err)
 		return
 	}
 
@@ -446,3 +789,40 @@ func (h *Handler) GetReports(c *gin.Context) {
 	c.Header("Content-Disposition", "attachment; filename=example.xlsx")
 	c.Data(200, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", buffer.Bytes())
 }
+
+// abortWithError отдает клиенту AppError с указанным статусом,
+// любую другую ошибку скрывает за 500
+func abortWithError(c *gin.Context, status int, err error) {
+	logger.Error.Println(err)
+
+	var appErr *apperror.AppError
+	if errors.As(err, &appErr) {
+		c.AbortWithStatusJSON(status, appErr)
+		return
+	}
+
+	c.AbortWithStatusJSON(500, apperror.ErrInternalServer)
+}
+
+func clientInfo(c *gin.Context) models.ClientInfo {
+	return models.ClientInfo{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
+
+// abortWithStepUp отвечает 401, если операция требует подтвердить сессию через /step-up
+func abortWithStepUp(c *gin.Context, status int, err error) {
+	if errors.Is(err, apperror.ErrStepUpRequired) {
+		c.Header("WWW-Authenticate", `Bearer error="insufficient_user_authentication"`)
+		status = 401
+	}
+	abortWithError(c, status, err)
+}
+
+func abortWithRetryAfter(c *gin.Context, retryAfter time.Duration, err error) {
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	abortWithError(c, 429, err)
+}
@@ -1,68 +1,132 @@
 package handler
 
 import (
-	"fmt"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 	"github.com/k4zb3k/project/internal/apperror"
 	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/internal/service"
 	"github.com/k4zb3k/project/pkg/logger"
 	"net/http"
-	"os"
 	"strings"
 )
 
 func (h *Handler) TokenAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID, err := h.TokenValid(c.Request)
+		if tokenString := h.ExtractToken(c.Request); service.IsApiKey(tokenString) {
+			key, user, err := h.Service.AuthenticateApiKey(tokenString)
+			if err != nil {
+				logger.Error.Println(err)
+				c.JSON(401, apperror.ErrUnauthorized)
+				c.Abort()
+				return
+			}
+			c.Set("user_id", key.UserID)
+			c.Set("scopes", key.Scopes)
+			c.Set("email_verified", user.EmailVerifiedAt != nil)
+			c.Set("email_missing", user.Email == "")
+
+			c.Next()
+			return
+		}
+
+		ad, err := h.ExtractTokenMetaData(c.Request)
+		if err != nil {
+			logger.Error.Println(err)
+			c.JSON(401, apperror.ErrUnauthorized)
+			c.Abort()
+			return
+		}
+
+		// токен мог быть отозван (logout) до истечения срока действия
+		user, err := h.Service.FetchAuth(ad)
 		if err != nil {
 			logger.Error.Println(err)
 			c.JSON(401, apperror.ErrUnauthorized)
 			c.Abort()
 			return
 		}
-		c.Set("user_id", userID)
+		c.Set("user_id", user.ID)
+		c.Set("email_verified", user.EmailVerifiedAt != nil)
+		c.Set("email_missing", user.Email == "")
+		c.Set("access_uuid", ad.AccessUuid)
+		c.Set("session_id", ad.SessionId)
+		c.Set("role", ad.Role)
 
 		c.Next()
 	}
 }
 
-func (h *Handler) TokenValid(r *http.Request) (string, error) {
-	token, err := h.VerifyToken(r)
-	if err != nil {
-		logger.Error.Println(err)
-		return "", err
-	}
+// RequireScope пропускает JWT сессии без ограничений, а API ключи только с нужным scope
+func (h *Handler) RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopes, isApiKey := c.Get("scopes")
+		if isApiKey && !scopes.(models.Scopes).Has(scope) {
+			h.accessDenied(c, "missing_scope")
+			c.JSON(403, apperror.ErrScope)
+			c.Abort()
+			return
+		}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok && !token.Valid {
-		logger.Error.Println(err)
-		return "", err
+		c.Next()
 	}
+}
 
-	userID := claims["user_id"].(string)
+// RequireSession закрывает маршрут для API ключей: управлять ключами,
+// 2FA и сессиями можно только после входа по паролю
+func (h *Handler) RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, isApiKey := c.Get("scopes"); isApiKey {
+			h.accessDenied(c, "api_key")
+			c.JSON(403, apperror.ErrForbidden)
+			c.Abort()
+			return
+		}
 
-	return userID, nil
+		c.Next()
+	}
 }
 
-func (h *Handler) VerifyToken(r *http.Request) (*jwt.Token, error) {
-	tokenString := h.ExtractToken(r)
-	err := os.Setenv("ACCESS_SECRET", "secret")
-	if err != nil {
-		logger.Error.Println(err)
-		return nil, fmt.Errorf("cannot set data")
+// RequireVerifiedEmail закрывает операции, меняющие данные, пока пользователь
+// не подтвердил почту. Читать свои данные можно и без подтверждения.
+// Пользователи, зарегистрированные до появления почты, пропускаются, пока не
+// укажут адрес через PATCH /me: после этого его тоже нужно подтвердить.
+func (h *Handler) RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("email_verified") && !c.GetBool("email_missing") {
+			h.accessDenied(c, "email_unverified")
+			c.JSON(403, apperror.ErrEmailUnverified)
+			c.Abort()
+			return
+		}
+
+		c.Next()
 	}
+}
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Make sure that the token method confirm to "SigningMethodHMAC"
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			logger.Error.Printf("unexpected signing method: %v", token.Header["alg"])
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+// RequireRole пропускает только пользователей с одной из перечисленных ролей.
+// Роль берется из access токена, поэтому маршрут должен стоять после TokenAuthMiddleware.
+func (h *Handler) RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
 		}
 
-		return []byte(os.Getenv("ACCESS_SECRET")), nil
-		// return []byte("secret"), nil
-	})
+		logger.Warn.Printf("user %s with role %q denied access to %s", c.GetString("user_id"), role, c.FullPath())
+		h.accessDenied(c, "role")
+		c.JSON(403, apperror.ErrForbidden)
+		c.Abort()
+	}
+}
+
+func (h *Handler) VerifyToken(r *http.Request) (*jwt.Token, error) {
+	tokenString := h.ExtractToken(r)
+
+	token, err := jwt.Parse(tokenString, h.Service.AccessKeys.Keyfunc)
 	if err != nil {
 		logger.Error.Println(err)
 		return nil, err
@@ -88,21 +152,31 @@ func (h *Handler) ExtractTokenMetaData(r *http.Request) (*models.AccessDetails,
 		return nil, err
 	}
 	claims, ok := token.Claims.(jwt.MapClaims)
-	if ok && token.Valid {
-		accessUuid, ok := claims["access_uuid"].(string)
-		if !ok {
-			logger.Error.Println(err)
-			return nil, err
-		}
+	if !ok || !token.Valid {
+		return nil, apperror.ErrInvalidToken
+	}
 
-		userId, ok := claims["user_id"].(string)
-		if !ok {
-			// TODO
-		}
-		return &models.AccessDetails{
-			AccessUuid: accessUuid,
-			UserId:     userId,
-		}, nil
+	accessUuid, ok := claims["access_uuid"].(string)
+	if !ok {
+		return nil, apperror.ErrInvalidToken
+	}
+
+	userId, ok := claims["user_id"].(string)
+	if !ok {
+		return nil, apperror.ErrInvalidToken
 	}
-	return nil, err
+
+	// sid и role нет в токенах, выданных до появления списка сессий и ролей
+	sessionId, _ := claims["sid"].(string)
+	role, ok := claims["role"].(string)
+	if !ok {
+		role = models.RoleUser
+	}
+
+	return &models.AccessDetails{
+		AccessUuid: accessUuid,
+		UserId:     userId,
+		SessionId:  sessionId,
+		Role:       role,
+	}, nil
 }
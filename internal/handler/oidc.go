@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+	"net/http"
+	"strings"
+)
+
+// state дополнительно хранится в cookie браузера, начавшего вход: ссылку callback,
+// открытую в другом браузере, принять нельзя (login CSRF)
+const oidcStateCookie = "oidc_state"
+
+// OidcStart перенаправляет пользователя на страницу входа внешнего провайдера
+func (h *Handler) OidcStart(c *gin.Context) {
+	authURL, state, err := h.Service.StartOidcLogin()
+	if err != nil {
+		abortWithError(c, 404, err)
+		return
+	}
+
+	h.setOidcStateCookie(c, state, int(h.Service.Config.Oidc.StateTTL.Seconds()))
+	c.Redirect(302, authURL)
+}
+
+func (h *Handler) OidcCallback(c *gin.Context) {
+	if errCode := c.Query("error"); errCode != "" {
+		logger.Error.Println("oidc provider returned error: ", errCode, c.Query("error_description"))
+		c.JSON(401, apperror.ErrUnauthorized)
+		return
+	}
+
+	cookie, _ := c.Cookie(oidcStateCookie)
+	h.setOidcStateCookie(c, "", -1)
+	if cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(c.Query("state"))) != 1 {
+		h.securityEvent(c, models.EventLogin, "", models.OutcomeFailure, models.EventDetails{
+			"method": "oidc",
+			"reason": "state cookie mismatch",
+		})
+		c.JSON(401, apperror.ErrUnauthorized)
+		return
+	}
+
+	userID, err := h.Service.CompleteOidcLogin(c.Query("state"), c.Query("code"))
+	if err != nil {
+		h.securityEvent(c, models.EventLogin, "", models.OutcomeFailure, models.EventDetails{
+			"method": "oidc",
+			"reason": err.Error(),
+		})
+		abortWithError(c, 401, err)
+		return
+	}
+
+	h.completeLogin(c, userID, "oidc")
+}
+
+// SameSite=Lax, а не Strict: провайдер возвращает браузер на callback переходом с другого сайта
+func (h *Handler) setOidcStateCookie(c *gin.Context, value string, maxAge int) {
+	secure := strings.HasPrefix(h.Service.Config.Oidc.RedirectURL, "https://")
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, value, maxAge, "/v1/auth/oidc", "", secure, true)
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/k4zb3k/project/internal/models"
+)
+
+func (h *Handler) BeginPasskeyRegistration(c *gin.Context) {
+	creation, err := h.Service.BeginPasskeyRegistration(c.GetString("user_id"), c.GetString("session_id"))
+	if err != nil {
+		abortWithStepUp(c, 400, err)
+		return
+	}
+
+	c.JSON(200, creation)
+}
+
+// FinishPasskeyRegistration принимает ответ navigator.credentials.create() как есть,
+// название ключа передается в query параметре name
+func (h *Handler) FinishPasskeyRegistration(c *gin.Context) {
+	credential, err := h.Service.FinishPasskeyRegistration(c.GetString("user_id"), c.Query("name"), c.Request.Body)
+	if err != nil {
+		abortWithError(c, 400, err)
+		return
+	}
+
+	c.JSON(201, credential)
+}
+
+func (h *Handler) GetPasskeys(c *gin.Context) {
+	credentials, err := h.Service.GetPasskeys(c.GetString("user_id"))
+	if err != nil {
+		abortWithError(c, 500, err)
+		return
+	}
+
+	c.JSON(200, credentials)
+}
+
+func (h *Handler) DeletePasskey(c *gin.Context) {
+	err := h.Service.DeletePasskey(c.GetString("user_id"), c.GetString("session_id"), c.Param("id"))
+	if err != nil {
+		abortWithStepUp(c, 404, err)
+		return
+	}
+
+	c.JSON(200, "passkey was deleted")
+}
+
+func (h *Handler) BeginPasskeyLogin(c *gin.Context) {
+	assertion, err := h.Service.BeginPasskeyLogin()
+	if err != nil {
+		abortWithError(c, 500, err)
+		return
+	}
+
+	c.JSON(200, assertion)
+}
+
+// FinishPasskeyLogin принимает ответ navigator.credentials.get() и выдает
+// такие же токены, как вход по паролю. Вход требует проверки пользователя
+// (PIN, биометрия), такой passkey уже двухфакторный, поэтому TOTP здесь не запрашивается.
+func (h *Handler) FinishPasskeyLogin(c *gin.Context) {
+	userID, err := h.Service.FinishPasskeyLogin(c.Request.Body)
+	if err != nil {
+		h.securityEvent(c, models.EventLogin, "", models.OutcomeFailure, models.EventDetails{
+			"method": "passkey",
+			"reason": err.Error(),
+		})
+		abortWithError(c, 401, err)
+		return
+	}
+
+	h.issueTokens(c, userID, "passkey")
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+)
+
+func (h *Handler) ForgotPassword(c *gin.Context) {
+	var req *models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Email == "" {
+		logger.Error.Println(err)
+		c.JSON(400, apperror.ErrBadRequest)
+		return
+	}
+
+	err := h.Service.RequestPasswordReset(req.Email)
+	if err != nil {
+		logger.Error.Println(err)
+		c.JSON(500, apperror.ErrInternalServer)
+		return
+	}
+
+	c.JSON(200, "if the email is registered, a reset link was sent to it")
+}
+
+func (h *Handler) ResetPassword(c *gin.Context) {
+	var req *models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error.Println(err)
+		c.JSON(400, apperror.ErrBadRequest)
+		return
+	}
+
+	userID, err := h.Service.ResetPassword(req)
+	if err != nil {
+		h.securityEvent(c, models.EventPasswordReset, userID, models.OutcomeFailure, models.EventDetails{"reason": err.Error()})
+		abortWithError(c, 400, err)
+		return
+	}
+	h.securityEvent(c, models.EventPasswordReset, userID, models.OutcomeSuccess, nil)
+
+	c.JSON(200, "password was changed")
+}
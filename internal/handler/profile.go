@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+)
+
+func (h *Handler) GetMe(c *gin.Context) {
+	u, err := h.Service.GetUser(c.GetString("user_id"))
+	if err != nil {
+		abortWithError(c, 404, err)
+		return
+	}
+
+	c.JSON(200, u.Info())
+}
+
+func (h *Handler) UpdateMe(c *gin.Context) {
+	var req *models.ProfileUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error.Println(err)
+		c.JSON(400, apperror.ErrBadRequest)
+		return
+	}
+
+	u, err := h.Service.UpdateProfile(c.GetString("user_id"), c.GetString("session_id"), req)
+	if err != nil {
+		var status int
+		switch {
+		case errors.Is(err, apperror.ErrStepUpRequired):
+			c.Header("WWW-Authenticate", `Bearer error="insufficient_user_authentication"`)
+			status = 401
+		case errors.Is(err, apperror.ErrUnauthorized):
+			status = 401
+		default:
+			status = 400
+		}
+		abortWithError(c, status, err)
+		return
+	}
+
+	c.JSON(200, u.Info())
+}
+
+func (h *Handler) ChangePassword(c *gin.Context) {
+	var req *models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error.Println(err)
+		c.JSON(400, apperror.ErrBadRequest)
+		return
+	}
+
+	err := h.Service.ChangePassword(c.GetString("user_id"), c.GetString("session_id"), req)
+	if err != nil {
+		h.securityEvent(c, models.EventPasswordChange, c.GetString("user_id"), models.OutcomeFailure, models.EventDetails{"reason": err.Error()})
+		abortWithStepUp(c, 400, err)
+		return
+	}
+	h.securityEvent(c, models.EventPasswordChange, c.GetString("user_id"), models.OutcomeSuccess, nil)
+
+	c.JSON(200, "password was changed")
+}
+
+func (h *Handler) DeleteMe(c *gin.Context) {
+	var req *models.DeleteUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error.Println(err)
+		c.JSON(400, apperror.ErrBadRequest)
+		return
+	}
+
+	err := h.Service.DeleteUser(c.GetString("user_id"), c.GetString("session_id"), req.Password)
+	if err != nil {
+		abortWithStepUp(c, 400, err)
+		return
+	}
+
+	c.JSON(200, "user was deleted")
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+)
+
+// securityEvent записывает событие журнала безопасности с IP и user agent запроса
+func (h *Handler) securityEvent(c *gin.Context, eventType, userID, outcome string, details models.EventDetails) {
+	event := &models.SecurityEvent{
+		Type:      eventType,
+		Outcome:   outcome,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Details:   details,
+	}
+	if userID != "" {
+		event.UserID = &userID
+	}
+
+	h.Service.RecordSecurityEvent(event)
+}
+
+// accessDenied записывает отказ в доступе к маршруту
+func (h *Handler) accessDenied(c *gin.Context, reason string) {
+	h.securityEvent(c, models.EventAccessDenied, c.GetString("user_id"), models.OutcomeDenied, models.EventDetails{
+		"method": c.Request.Method,
+		"path":   c.FullPath(),
+		"reason": reason,
+	})
+}
+
+func (h *Handler) GetMySecurityEvents(c *gin.Context) {
+	var filter models.SecurityEventFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		logger.Error.Println(err)
+		c.JSON(400, apperror.ErrBadRequest)
+		return
+	}
+	filter.UserID = c.GetString("user_id")
+
+	events, err := h.Service.GetSecurityEvents(&filter)
+	if err != nil {
+		logger.Error.Println(err)
+		c.JSON(500, apperror.ErrInternalServer)
+		return
+	}
+
+	c.JSON(200, events)
+}
+
+func (h *Handler) AdminGetSecurityEvents(c *gin.Context) {
+	var filter models.SecurityEventFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		logger.Error.Println(err)
+		c.JSON(400, apperror.ErrBadRequest)
+		return
+	}
+
+	events, err := h.Service.GetSecurityEvents(&filter)
+	if err != nil {
+		logger.Error.Println(err)
+		c.JSON(500, apperror.ErrInternalServer)
+		return
+	}
+
+	c.JSON(200, events)
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/pkg/logger"
+)
+
+func (h *Handler) GetSessions(c *gin.Context) {
+	sessions, err := h.Service.GetSessions(c.GetString("user_id"), c.GetString("session_id"))
+	if err != nil {
+		logger.Error.Println(err)
+		c.JSON(500, apperror.ErrInternalServer)
+		return
+	}
+
+	c.JSON(200, sessions)
+}
+
+func (h *Handler) RevokeSession(c *gin.Context) {
+	err := h.Service.RevokeSession(c.GetString("user_id"), c.Param("id"))
+	if err != nil {
+		abortWithError(c, 404, err)
+		return
+	}
+
+	c.JSON(200, "session was revoked")
+}
@@ -0,0 +1,17 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// CreateSignupChallenge выдает proof-of-work задачу. Решение передается
+// в POST /v1/auth/create заголовками X-Pow-Challenge и X-Pow-Nonce.
+func (h *Handler) CreateSignupChallenge(c *gin.Context) {
+	challenge, err := h.Service.CreateSignupChallenge()
+	if err != nil {
+		abortWithError(c, 500, err)
+		return
+	}
+
+	c.JSON(200, challenge)
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+)
+
+func (h *Handler) StepUp(c *gin.Context) {
+	var req *models.StepUpRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error.Println(err)
+		c.JSON(400, apperror.ErrBadRequest)
+		return
+	}
+
+	userID := c.GetString("user_id")
+	retryAfter, err := h.Service.StepUp(userID, c.GetString("session_id"), c.ClientIP(), req)
+	if err != nil {
+		h.securityEvent(c, models.EventStepUp, userID, models.OutcomeFailure, models.EventDetails{"reason": err.Error()})
+		if errors.Is(err, apperror.ErrAccountLocked) || errors.Is(err, apperror.ErrTooManyLogins) {
+			abortWithRetryAfter(c, retryAfter, err)
+			return
+		}
+		abortWithError(c, 401, err)
+		return
+	}
+	h.securityEvent(c, models.EventStepUp, userID, models.OutcomeSuccess, nil)
+
+	c.JSON(200, "re-authentication confirmed")
+}
+
+func (h *Handler) BeginStepUpPasskey(c *gin.Context) {
+	assertion, err := h.Service.BeginStepUpPasskey(c.GetString("user_id"), c.GetString("session_id"))
+	if err != nil {
+		abortWithError(c, 400, err)
+		return
+	}
+
+	c.JSON(200, assertion)
+}
+
+// FinishStepUpPasskey принимает ответ navigator.credentials.get() как есть
+func (h *Handler) FinishStepUpPasskey(c *gin.Context) {
+	userID := c.GetString("user_id")
+	err := h.Service.FinishStepUpPasskey(userID, c.GetString("session_id"), c.Request.Body)
+	if err != nil {
+		h.securityEvent(c, models.EventStepUp, userID, models.OutcomeFailure, models.EventDetails{
+			"method": "passkey",
+			"reason": err.Error(),
+		})
+		abortWithError(c, 401, err)
+		return
+	}
+	h.securityEvent(c, models.EventStepUp, userID, models.OutcomeSuccess, models.EventDetails{"method": "passkey"})
+
+	c.JSON(200, "re-authentication confirmed")
+}
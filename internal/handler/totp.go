@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+)
+
+func (h *Handler) LoginTotp(c *gin.Context) {
+	var req *models.LoginChallenge
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error.Println(err)
+		c.JSON(400, apperror.ErrBadRequest)
+		return
+	}
+
+	userID, retryAfter, err := h.Service.CompleteLoginChallenge(req, c.ClientIP())
+	if err != nil {
+		h.securityEvent(c, models.EventLogin, "", models.OutcomeFailure, models.EventDetails{
+			"method": "totp",
+			"reason": "invalid_code",
+		})
+		if errors.Is(err, apperror.ErrAccountLocked) || errors.Is(err, apperror.ErrTooManyLogins) {
+			abortWithRetryAfter(c, retryAfter, err)
+			return
+		}
+		abortWithError(c, 401, err)
+		return
+	}
+
+	h.issueTokens(c, userID, "totp")
+}
+
+func (h *Handler) EnrollTotp(c *gin.Context) {
+	enrollment, err := h.Service.StartTotpEnrollment(c.GetString("user_id"))
+	if err != nil {
+		abortWithError(c, 400, err)
+		return
+	}
+
+	c.JSON(200, enrollment)
+}
+
+func (h *Handler) ConfirmTotp(c *gin.Context) {
+	var req *models.TotpRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error.Println(err)
+		c.JSON(400, apperror.ErrBadRequest)
+		return
+	}
+
+	codes, err := h.Service.ConfirmTotpEnrollment(c.GetString("user_id"), req.Code)
+	if err != nil {
+		abortWithError(c, 400, err)
+		return
+	}
+
+	c.JSON(200, map[string][]string{
+		"recovery_codes": codes,
+	})
+}
+
+func (h *Handler) DisableTotp(c *gin.Context) {
+	var req *models.TotpRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error.Println(err)
+		c.JSON(400, apperror.ErrBadRequest)
+		return
+	}
+
+	err := h.Service.DisableTotp(c.GetString("user_id"), req.Code)
+	if err != nil {
+		abortWithError(c, 400, err)
+		return
+	}
+
+	c.JSON(200, "two-factor authentication was disabled")
+}
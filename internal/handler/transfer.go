@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+)
+
+// Transfer переводит деньги между счетами пользователя одной операцией
+func (h *Handler) Transfer(c *gin.Context) {
+	var req models.TransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Error.Println(err)
+		c.JSON(400, apperror.ErrBadRequest)
+		return
+	}
+
+	transfer, err := h.Service.Transfer(c.GetString("user_id"), c.GetString("session_id"), &req)
+	if err != nil {
+		var status int
+		switch {
+		case errors.Is(err, apperror.ErrStepUpRequired):
+			c.Header("WWW-Authenticate", `Bearer error="insufficient_user_authentication"`)
+			status = 401
+		case errors.Is(err, apperror.ErrNotFound):
+			status = 404
+		case errors.Is(err, apperror.ErrRateNotFound), errors.Is(err, apperror.ErrRateMismatch):
+			status = 422
+		default:
+			status = 400
+		}
+		abortWithError(c, status, err)
+		return
+	}
+
+	c.JSON(201, transfer)
+}
@@ -1,18 +1,180 @@
 package models
 
-import "time"
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
 
 type User struct {
-	ID       string `gorm:"type:uuid;default:uuid_generate_v4()"`
-	Username string `json:"username"`
+	ID              string         `gorm:"type:uuid;default:uuid_generate_v4()"`
+	Username        string         `json:"username"`
+	Email           string         `json:"email"`
+	EmailVerifiedAt *time.Time     `json:"-"`
+	Password        string         `json:"password"`
+	PasswordUnset   bool           `json:"-"` // пароль создан случайно при входе через OIDC
+	TotpSecret      string         `json:"-"`
+	TotpEnabled     bool           `json:"-"`
+	Role            string         `json:"-"`
+	DisabledAt      *time.Time     `json:"-"`
+	CreatedAt       time.Time      `json:"-"`
+	UpdatedAt       time.Time      `json:"-"`
+	DeletedAt       gorm.DeletedAt `json:"-"`
+}
+
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+// UserInfo - представление пользователя в ответах API, без пароля и секретов
+type UserInfo struct {
+	ID            string    `json:"id"`
+	Username      string    `json:"username"`
+	Email         string    `json:"email,omitempty"`
+	EmailVerified bool      `json:"email_verified"`
+	Role          string    `json:"role"`
+	TotpEnabled   bool      `json:"totp_enabled"`
+	Disabled      bool      `json:"disabled"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func (u *User) Info() UserInfo {
+	return UserInfo{
+		ID:            u.ID,
+		Username:      u.Username,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerifiedAt != nil,
+		Role:          u.Role,
+		TotpEnabled:   u.TotpEnabled,
+		Disabled:      u.DisabledAt != nil,
+		CreatedAt:     u.CreatedAt,
+	}
+}
+
+type UserFilter struct {
+	Search string `form:"search"`
+	Role   string `form:"role"`
+	Limit  int    `form:"limit"`
+	Page   int    `form:"page"`
+}
+
+// ProfileUpdate - изменение профиля. Для смены почты нужен текущий пароль
+// или недавнее подтверждение через /v1/api/step-up.
+type ProfileUpdate struct {
+	Username        *string `json:"username"`
+	Email           *string `json:"email"`
+	CurrentPassword string  `json:"current_password"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type DeleteUserRequest struct {
+	Password string `json:"password"`
+}
+
+type RoleRequest struct {
+	Role string `json:"role"`
+}
+
+// UserIdentity связывает пользователя с учетной записью у внешнего OIDC провайдера
+type UserIdentity struct {
+	ID        string    `json:"id" gorm:"type:uuid;default:uuid_generate_v4()"`
+	UserID    string    `json:"-"`
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebAuthnCredential - passkey пользователя. Ключ и служебные поля
+// нужны только для проверки подписи и наружу не отдаются.
+type WebAuthnCredential struct {
+	ID              string     `json:"id" gorm:"type:uuid;default:uuid_generate_v4()"`
+	UserID          string     `json:"-"`
+	Name            string     `json:"name"`
+	CredentialID    []byte     `json:"-"`
+	PublicKey       []byte     `json:"-"`
+	AttestationType string     `json:"-"`
+	Transports      Scopes     `json:"transports" gorm:"type:text"`
+	AAGUID          []byte     `json:"-" gorm:"column:aaguid"`
+	SignCount       uint32     `json:"-"`
+	BackupEligible  bool       `json:"-"`
+	BackupState     bool       `json:"-"`
+	LastUsedAt      *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// KnownDevice - сочетание user agent и подсети, с которых пользователь уже входил
+type KnownDevice struct {
+	ID            string    `json:"id" gorm:"type:uuid;default:uuid_generate_v4()"`
+	UserID        string    `json:"-"`
+	UserAgentHash string    `json:"-"`
+	UserAgent     string    `json:"user_agent"`
+	IPRange       string    `json:"ip_range" gorm:"column:ip_range"`
+	FirstSeenAt   time.Time `json:"first_seen_at"`
+	LastSeenAt    time.Time `json:"last_seen_at"`
+}
+
+type RecoveryCode struct {
+	ID        string `gorm:"type:uuid;default:uuid_generate_v4()"`
+	UserID    string
+	CodeHash  string
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+type TotpEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type TotpRequest struct {
+	Code string `json:"code"`
+}
+
+// StepUpRequest подтверждает личность внутри сессии паролем или TOTP кодом.
+// Passkey подтверждается отдельно через /v1/api/step-up/passkey/begin и finish.
+type StepUpRequest struct {
 	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// StepUpChallenge возвращается в details ошибки, когда операция требует повторной проверки
+type StepUpChallenge struct {
+	Methods  []string `json:"methods"`
+	Endpoint string   `json:"endpoint"`
+	MaxAge   int      `json:"max_age"`
+}
+
+// SignupChallenge - задача для регистрации: нужно найти nonce, при котором
+// sha256(challenge + ":" + nonce) начинается с Difficulty нулевых бит
+type SignupChallenge struct {
+	Challenge  string `json:"challenge"`
+	Difficulty int    `json:"difficulty"`
+	ExpiresIn  int    `json:"expires_in"`
+}
+
+type LoginChallenge struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
 }
 
 type TokenDetails struct {
+	UserID       string `json:"user_id"`
 	AccessToken  string `json:"access_token"`
 	RefreshToken string `json:"refresh_token"`
 	AccessUuid   string `json:"access_uuid"`
 	RefreshUuid  string `json:"refresh_uuid"`
+	SessionID    string `json:"session_id"`
 	AtExpires    int64  `json:"at_expires"`
 	RtExpires    int64  `json:"rt_expires"`
 }
@@ -20,6 +182,205 @@ type TokenDetails struct {
 type AccessDetails struct {
 	AccessUuid string `json:"access_uuid"`
 	UserId     string `json:"user_id"`
+	SessionId  string `json:"session_id"`
+	Role       string `json:"role"`
+}
+
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+type Session struct {
+	ID        string    `json:"id"`
+	UserAgent string    `json:"user_agent"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	Current   bool      `json:"current"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// UnlockRequest - досрочное снятие блокировки: кодом TOTP, кодом восстановления
+// или токеном из письма (для пользователей без 2FA)
+type UnlockRequest struct {
+	Username     string `json:"username"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+	Token        string `json:"token"`
+}
+
+type UnlockEmailRequest struct {
+	Username string `json:"username"`
+}
+
+const (
+	ScopeAccountsRead      = "accounts:read"
+	ScopeAccountsWrite     = "accounts:write"
+	ScopeTransactionsRead  = "transactions:read"
+	ScopeTransactionsWrite = "transactions:write"
+	ScopeReportsRead       = "reports:read"
+)
+
+var AllScopes = Scopes{
+	ScopeAccountsRead,
+	ScopeAccountsWrite,
+	ScopeTransactionsRead,
+	ScopeTransactionsWrite,
+	ScopeReportsRead,
+}
+
+// Scopes хранится в БД одной строкой через пробел
+type Scopes []string
+
+func (s Scopes) Has(scope string) bool {
+	for _, v := range s {
+		if v == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Scopes) Value() (driver.Value, error) {
+	return strings.Join(s, " "), nil
+}
+
+func (s *Scopes) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case string:
+		*s = strings.Fields(v)
+	case []byte:
+		*s = strings.Fields(string(v))
+	case nil:
+		*s = nil
+	default:
+		return fmt.Errorf("cannot scan %T into Scopes", src)
+	}
+	return nil
+}
+
+const (
+	EventSignup         = "signup"
+	EventLogin          = "login"
+	EventTokenRefresh   = "token_refresh"
+	EventLogout         = "logout"
+	EventLogoutAll      = "logout_all"
+	EventPasswordChange = "password_change"
+	EventPasswordReset  = "password_reset"
+	EventLockout        = "lockout"
+	EventAccessDenied   = "access_denied"
+	EventStepUp         = "step_up"
+	EventNewDevice      = "new_device"
+	EventDeviceReported = "device_reported"
+	EventEmailChange    = "email_change"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeDenied  = "denied"
+)
+
+// SecurityEvent - запись журнала безопасности. UserID пустой, если
+// пользователя определить не удалось (например, неверный refresh токен).
+type SecurityEvent struct {
+	ID        string       `json:"id" gorm:"type:uuid;default:uuid_generate_v4()"`
+	UserID    *string      `json:"user_id,omitempty"`
+	Type      string       `json:"type"`
+	Outcome   string       `json:"outcome"`
+	IP        string       `json:"ip"`
+	UserAgent string       `json:"user_agent"`
+	Details   EventDetails `json:"details,omitempty" gorm:"type:jsonb"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+type EventDetails map[string]string
+
+func (d EventDetails) Value() (driver.Value, error) {
+	if len(d) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *EventDetails) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), d)
+	case []byte:
+		return json.Unmarshal(v, d)
+	case nil:
+		*d = nil
+	default:
+		return fmt.Errorf("cannot scan %T into EventDetails", src)
+	}
+	return nil
+}
+
+type SecurityEventFilter struct {
+	UserID  string    `form:"user_id"`
+	Type    string    `form:"type"`
+	Outcome string    `form:"outcome"`
+	IP      string    `form:"ip"`
+	From    time.Time `form:"from"`
+	To      time.Time `form:"to"`
+	Limit   int       `form:"limit"`
+	Page    int       `form:"page"`
+}
+
+type ApiKey struct {
+	ID         string     `json:"id" gorm:"type:uuid;default:uuid_generate_v4()"`
+	UserID     string     `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     Scopes     `json:"scopes" gorm:"type:text"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type ApiKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"`
 }
 
 type Token struct {
@@ -30,21 +391,100 @@ type Token struct {
 type Account struct {
 	ID        string    `gorm:"type:uuid;default:uuid_generate_v4()"`
 	UserID    string    `json:"user_id,omitempty"`
+	Name      string    `json:"name"`
 	Number    string    `json:"number"`
+	Currency  string    `json:"currency"` // ISO 4217, задается при создании и дальше не меняется
 	Balance   float64   `json:"balance"`
+	Metadata  Metadata  `json:"metadata,omitempty" gorm:"type:jsonb"`
+	Version   int       `json:"version" gorm:"default:1"`
 	CreatedAt time.Time `json:"created_at,omitempty"`
 	UpdatedAt time.Time `json:"updated_at,omitempty"`
-	DeletedAt time.Time `json:"deleted_at,omitempty"`
+	// закрытый счет скрыт из списков и не принимает транзакции, но его можно восстановить
+	DeletedAt gorm.DeletedAt `json:"closed_at"`
+}
+
+// CloseAccountRequest - при ненулевом балансе его нужно перевести на другой счет пользователя
+type CloseAccountRequest struct {
+	TransferTo string `json:"transfer_to"`
+}
+
+// AccountUpdate - поля счета, которые может менять владелец. Version - версия,
+// которую клиент видел последней; если счет с тех пор изменился, вернется 409.
+type AccountUpdate struct {
+	Name     *string   `json:"name"`
+	Number   *string   `json:"number"`
+	Metadata *Metadata `json:"metadata"`
+	Version  int       `json:"version"`
+}
+
+// Metadata - произвольные данные клиента, хранятся в jsonb
+type Metadata map[string]interface{}
+
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (m *Metadata) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), m)
+	case []byte:
+		return json.Unmarshal(v, m)
+	case nil:
+		*m = nil
+	default:
+		return fmt.Errorf("cannot scan %T into Metadata", src)
+	}
+	return nil
 }
 
 type Transaction struct {
-	ID        string  `gorm:"type:uuid;default:uuid_generate_v4()"`
-	AccountID string  `json:"account_id"`
-	Type      string  `json:"type"`
-	Amount    float64 `json:"amount"`
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	DeletedAt time.Time
+	ID         string  `gorm:"type:uuid;default:uuid_generate_v4()"`
+	AccountID  string  `json:"account_id"`
+	Type       string  `json:"type"`
+	Amount     float64 `json:"amount"`
+	Currency   string  `json:"currency"`
+	TransferID *string `json:"transfer_id,omitempty" gorm:"type:uuid"` // общий у двух операций перевода
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	DeletedAt  time.Time
+}
+
+// Операции перевода между своими счетами. Это не доходы и не расходы,
+// поэтому в отчетах и итогах они учитываются отдельно.
+const (
+	TransactionTransferOut = "transfer_out"
+	TransactionTransferIn  = "transfer_in"
+	TransactionTransfer    = "transfer" // фильтр отчета по обеим операциям перевода
+)
+
+// TransferRequest - перевод между своими счетами. Amount указывается в валюте
+// счета списания. Rate для счетов в разных валютах необязателен: без него берется
+// курс из fx_rates, а переданный не должен сильно от него отличаться.
+type TransferRequest struct {
+	FromAccountID string  `json:"from_account_id"`
+	ToAccountID   string  `json:"to_account_id"`
+	Amount        float64 `json:"amount"`
+	Rate          float64 `json:"rate,omitempty"`
+}
+
+type Transfer struct {
+	ID               string    `json:"id"`
+	FromAccountID    string    `json:"from_account_id"`
+	ToAccountID      string    `json:"to_account_id"`
+	Amount           float64   `json:"amount"`
+	Currency         string    `json:"currency"`
+	CreditedAmount   float64   `json:"credited_amount"`
+	CreditedCurrency string    `json:"credited_currency"`
+	Rate             float64   `json:"rate"`
+	CreatedAt        time.Time `json:"created_at"`
 }
 
 type Report struct {
@@ -55,6 +495,32 @@ type Report struct {
 	Page      int       `json:"page,omitempty"`
 	DateFrom  string    `json:"date_from,omitempty"`
 	DateTo    string    `json:"date_to,omitempty"`
+	Currency  string    `json:"currency,omitempty"` // валюта пересчета, пусто - без пересчета
 	From      time.Time `json:"-"`
 	To        time.Time `json:"-"`
 }
+
+// FxRate - курс валюты на дату: за 1 единицу Base дают Rate единиц Quote
+type FxRate struct {
+	Date      time.Time `json:"date" gorm:"type:date;primaryKey"`
+	Base      string    `json:"base" gorm:"primaryKey"`
+	Quote     string    `json:"quote" gorm:"primaryKey"`
+	Rate      float64   `json:"rate"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"-"`
+}
+
+type FxImportResult struct {
+	Source   string `json:"source"`
+	Imported int    `json:"imported"`
+}
+
+// Totals - обороты пользователя по всем счетам в одной валюте
+type Totals struct {
+	Currency string  `json:"currency"`
+	Income   float64 `json:"income"`
+	Expense  float64 `json:"expense"`
+	Net      float64 `json:"net"`
+	DateFrom string  `json:"date_from,omitempty"`
+	DateTo   string  `json:"date_to,omitempty"`
+}
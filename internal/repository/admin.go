@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+	"time"
+)
+
+func (r *Repository) SearchUsers(filter *models.UserFilter) (users []models.User, err error) {
+	query := r.Connection.Model(&models.User{})
+
+	if filter.Search != "" {
+		pattern := "%" + filter.Search + "%"
+		query = query.Where("username ilike ? or email ilike ?", pattern, pattern)
+	}
+	if filter.Role != "" {
+		query = query.Where("role = ?", filter.Role)
+	}
+
+	page := 1
+	limit := 50
+
+	if filter.Page > 0 {
+		page = filter.Page
+	}
+	if filter.Limit > 0 && filter.Limit <= 100 {
+		limit = filter.Limit
+	}
+
+	err = query.Order("created_at desc").Limit(limit).Offset((page - 1) * limit).Find(&users).Error
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (r *Repository) SetUserDisabled(userID string, disabled bool) (bool, error) {
+	var disabledAt interface{}
+	if disabled {
+		disabledAt = time.Now()
+	}
+
+	tx := r.Connection.Model(&models.User{}).Where("id = ?", userID).
+		Updates(map[string]interface{}{"disabled_at": disabledAt, "updated_at": time.Now()})
+	if tx.Error != nil {
+		logger.Error.Println(tx.Error)
+		return false, tx.Error
+	}
+
+	return tx.RowsAffected == 1, nil
+}
+
+func (r *Repository) SetUserRole(userID, role string) (bool, error) {
+	tx := r.Connection.Model(&models.User{}).Where("id = ?", userID).
+		Updates(map[string]interface{}{"role": role, "updated_at": time.Now()})
+	if tx.Error != nil {
+		logger.Error.Println(tx.Error)
+		return false, tx.Error
+	}
+
+	return tx.RowsAffected == 1, nil
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+	"time"
+)
+
+func (r *Repository) CreateApiKey(key *models.ApiKey) error {
+	err := r.Connection.Omit("last_used_at", "revoked_at", "created_at").Create(key).Error
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *Repository) GetApiKeys(userID string) (keys []models.ApiKey, err error) {
+	err = r.Connection.Where("user_id = ? and revoked_at is null", userID).
+		Order("created_at desc").Find(&keys).Error
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (r *Repository) GetApiKeyByHash(keyHash string) (*models.ApiKey, error) {
+	var keys []models.ApiKey
+
+	err := r.Connection.Where("key_hash = ? and revoked_at is null", keyHash).Limit(1).Find(&keys).Error
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	return &keys[0], nil
+}
+
+func (r *Repository) RevokeApiKey(userID, id string) (bool, error) {
+	tx := r.Connection.Model(&models.ApiKey{}).
+		Where("id = ? and user_id = ? and revoked_at is null", id, userID).
+		Update("revoked_at", time.Now())
+	if tx.Error != nil {
+		logger.Error.Println(tx.Error)
+		return false, tx.Error
+	}
+
+	return tx.RowsAffected == 1, nil
+}
+
+func (r *Repository) TouchApiKey(id string) error {
+	err := r.Connection.Model(&models.ApiKey{}).Where("id = ?", id).
+		Update("last_used_at", time.Now()).Error
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
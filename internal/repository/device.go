@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+	"time"
+)
+
+func (r *Repository) GetKnownDevices(userID string) (devices []models.KnownDevice, err error) {
+	err = r.Connection.Where("user_id = ?", userID).Order("last_seen_at desc").Find(&devices).Error
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+func (r *Repository) CreateKnownDevice(device *models.KnownDevice) error {
+	err := r.Connection.Omit("first_seen_at", "last_seen_at").Create(device).Error
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *Repository) TouchKnownDevice(id string) error {
+	err := r.Connection.Model(&models.KnownDevice{}).Where("id = ?", id).
+		Update("last_seen_at", time.Now()).Error
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *Repository) DeleteKnownDevice(userID, id string) (bool, error) {
+	tx := r.Connection.Where("id = ? and user_id = ?", id, userID).Delete(&models.KnownDevice{})
+	if tx.Error != nil {
+		logger.Error.Println(tx.Error)
+		return false, tx.Error
+	}
+
+	return tx.RowsAffected == 1, nil
+}
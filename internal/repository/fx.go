@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// SaveFxRates сохраняет курсы, повторный импорт того же файла перезаписывает значения
+func (r *Repository) SaveFxRates(rates []models.FxRate) error {
+	err := r.Connection.Omit("created_at").Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "base"}, {Name: "quote"}, {Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "source"}),
+	}).CreateInBatches(rates, 1000).Error
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// GetFxRate возвращает последний курс на дату date, но не старше since.
+// nil означает, что курса за этот период нет.
+func (r *Repository) GetFxRate(base, quote string, date, since time.Time) (*models.FxRate, error) {
+	var rates []models.FxRate
+
+	err := r.Connection.Where("base = ? and quote = ? and date <= ? and date >= ?",
+		base, quote, date.Format("2006-01-02"), since.Format("2006-01-02")).
+		Order("date desc").Limit(1).Find(&rates).Error
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+	if len(rates) == 0 {
+		return nil, nil
+	}
+
+	return &rates[0], nil
+}
+
+// GetUserTransactions возвращает операции по всем счетам пользователя, включая закрытые
+func (r *Repository) GetUserTransactions(userID string, from, to time.Time) (tr []models.Transaction, err error) {
+	query := r.Connection.Model(&models.Transaction{}).Select("transactions.*").
+		Joins("join accounts on accounts.id = transactions.account_id").
+		Where("accounts.user_id = ?", userID)
+
+	if !from.IsZero() {
+		query = query.Where("transactions.created_at >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("transactions.created_at <= ?", to)
+	}
+
+	err = query.Find(&tr).Error
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	return tr, nil
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+	"gorm.io/gorm"
+)
+
+func (r *Repository) GetUserIdentity(issuer, subject string) (*models.UserIdentity, error) {
+	var identities []models.UserIdentity
+
+	err := r.Connection.Where("issuer = ? and subject = ?", issuer, subject).Limit(1).Find(&identities).Error
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+	if len(identities) == 0 {
+		return nil, nil
+	}
+
+	return &identities[0], nil
+}
+
+func (r *Repository) CreateUserIdentity(identity *models.UserIdentity) error {
+	err := r.Connection.Omit("created_at").Create(identity).Error
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// CreateUserWithIdentity создает пользователя вместе с привязкой к внешней учетной записи
+func (r *Repository) CreateUserWithIdentity(user *models.User, identity *models.UserIdentity) (string, error) {
+	err := r.Connection.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(user).Error
+		if err != nil {
+			return userUniqueError(err)
+		}
+
+		identity.UserID = user.ID
+		return tx.Omit("created_at").Create(identity).Error
+	})
+	if err != nil {
+		logger.Error.Println(err)
+		return "", err
+	}
+
+	return user.ID, nil
+}
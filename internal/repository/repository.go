@@ -2,14 +2,18 @@ package repository
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/k4zb3k/project/internal/apperror"
 	"github.com/k4zb3k/project/internal/models"
 	"github.com/k4zb3k/project/pkg/logger"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"time"
 )
 
+const uniqueViolation = "23505"
+
 type Repository struct {
 	Connection *gorm.DB
 }
@@ -23,30 +27,37 @@ func NewRepository(conn *gorm.DB) *Repository {
 //==================================================
 
 func (r *Repository) ExistsUser(username string) (bool, error) {
-	var u models.User
-	err := r.Connection.Where("username = ?", username).Error
+	var count int64
+	err := r.Connection.Model(&models.User{}).Where("lower(username) = lower(?)", username).Count(&count).Error
 	if err != nil {
 		return false, err
 	}
-	if u == (models.User{}) {
-		return false, nil
+
+	return count > 0, nil
+}
+
+func (r *Repository) ExistsEmail(email string) (bool, error) {
+	var count int64
+	err := r.Connection.Model(&models.User{}).Where("lower(email) = lower(?)", email).Count(&count).Error
+	if err != nil {
+		return false, err
 	}
 
-	return true, nil
+	return count > 0, nil
 }
 
 func (r *Repository) CreateUser(ctx context.Context, user *models.User) (userID string, err error) {
 	err = r.Connection.WithContext(ctx).Create(&user).Error
 	if err != nil {
 		logger.Error.Println("failed to create user")
-		return "", err
+		return "", userUniqueError(err)
 	}
 
 	return user.ID, nil
 }
 
 func (r *Repository) CheckUser(user *models.User) (u *models.User, err error) {
-	if tx := r.Connection.Where("username = ?", user.Username).Find(&u); tx.Error != nil {
+	if tx := r.Connection.Where("lower(username) = lower(?)", user.Username).Find(&u); tx.Error != nil {
 		logger.Error.Println("failed to user", err)
 		return u, tx.Error
 	}
@@ -58,10 +69,11 @@ func (r *Repository) CheckUser(user *models.User) (u *models.User, err error) {
 	return u, nil
 }
 
+// ExistsAccount учитывает и закрытые счета: номер остается за счетом, пока его можно восстановить
 func (r *Repository) ExistsAccount(number string) (bool, error) {
 	var acc *models.Account
 
-	err := r.Connection.Where("number = ?", number).Find(&acc).Error
+	err := r.Connection.Unscoped().Where("number = ?", number).Find(&acc).Error
 	if err != nil {
 		logger.Error.Println(err)
 		return false, err
@@ -83,8 +95,13 @@ func (r *Repository) CreateAccount(account *models.Account) error {
 	return nil
 }
 
-func (r *Repository) GetAccounts(userID string) (accounts []models.Account, err error) {
-	err = r.Connection.Where("user_id = ?", userID).Find(&accounts).Error
+func (r *Repository) GetAccounts(userID string, includeClosed bool) (accounts []models.Account, err error) {
+	query := r.Connection
+	if includeClosed {
+		query = query.Unscoped()
+	}
+
+	err = query.Where("user_id = ?", userID).Find(&accounts).Error
 	if err != nil {
 		logger.Error.Println(err)
 		return nil, err
@@ -93,8 +110,9 @@ func (r *Repository) GetAccounts(userID string) (accounts []models.Account, err
 	return accounts, nil
 }
 
+// GetAccountById возвращает и закрытый счет, вызывающий проверяет DeletedAt сам
 func (r *Repository) GetAccountById(userID, id string) (account models.Account, err error) {
-	err = r.Connection.Where("user_id = ? and id = ?", userID, id).Find(&account).Error
+	err = r.Connection.Unscoped().Where("user_id = ? and id = ?", userID, id).Find(&account).Error
 	if err != nil {
 		logger.Error.Println(err)
 		return models.Account{}, err
@@ -103,8 +121,96 @@ func (r *Repository) GetAccountById(userID, id string) (account models.Account,
 	return account, nil
 }
 
-func (r *Repository) UpdateAccount(account *models.Account) error {
-	err := r.Connection.Save(account).Error
+// UpdateAccount меняет поля счета, только если его версия не изменилась с момента чтения.
+// false означает, что счет изменили параллельно или он не принадлежит пользователю.
+func (r *Repository) UpdateAccount(userID, id string, version int, fields map[string]interface{}) (bool, error) {
+	fields["version"] = gorm.Expr("version + 1")
+	fields["updated_at"] = time.Now()
+
+	tx := r.Connection.Model(&models.Account{}).
+		Where("id = ? and user_id = ? and version = ?", id, userID, version).
+		Updates(fields)
+	if tx.Error != nil {
+		logger.Error.Println(tx.Error)
+		return false, tx.Error
+	}
+
+	return tx.RowsAffected == 1, nil
+}
+
+// changeBalance изменяет баланс одним запросом, без чтения и перезаписи всей строки.
+// Закрытые счета не обновляются, даже если счет закрыли между проверкой и записью.
+func changeBalance(tx *gorm.DB, accountID string, delta float64) error {
+	res := tx.Model(&models.Account{}).Where("id = ?", accountID).
+		Updates(map[string]interface{}{"balance": gorm.Expr("balance + ?", delta), "updated_at": time.Now()})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return apperror.ErrAccountClosed
+	}
+
+	return nil
+}
+
+// CloseAccount закрывает счет. Ненулевой баланс в той же транзакции переводится
+// на счет transferTo того же пользователя переводом с идентификатором transferID.
+func (r *Repository) CloseAccount(userID, id, transferTo, transferID string) error {
+	err := r.Connection.Transaction(func(tx *gorm.DB) error {
+		var account models.Account
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? and user_id = ?", id, userID).Take(&account).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apperror.ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if account.Balance != 0 {
+			if transferTo == "" {
+				return apperror.ErrAccountNotEmpty.WithDetails(map[string]float64{"balance": account.Balance})
+			}
+			if transferTo == id {
+				return apperror.ErrBadRequest
+			}
+
+			var target models.Account
+			err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id = ? and user_id = ?", transferTo, userID).Take(&target).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return apperror.ErrNotFound
+			}
+			if err != nil {
+				return err
+			}
+			if target.Currency != account.Currency {
+				return apperror.ErrWrongCurrency
+			}
+
+			// отрицательный баланс погашается переводом в обратную сторону
+			from, to, amount := account.ID, target.ID, account.Balance
+			if amount < 0 {
+				from, to, amount = target.ID, account.ID, -amount
+			}
+
+			err = transfer(tx, &models.Transfer{
+				ID:               transferID,
+				FromAccountID:    from,
+				ToAccountID:      to,
+				Amount:           amount,
+				Currency:         account.Currency,
+				CreditedAmount:   amount,
+				CreditedCurrency: account.Currency,
+				Rate:             1,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Delete(&account).Error
+	})
 	if err != nil {
 		logger.Error.Println(err)
 		return err
@@ -113,8 +219,33 @@ func (r *Repository) UpdateAccount(account *models.Account) error {
 	return nil
 }
 
-func (r *Repository) CreateTransaction(tr *models.Transaction) error {
-	err := r.Connection.Omit("created_at", "updated_at", "deleted_at").Create(&tr).Error
+func (r *Repository) RestoreAccount(userID, id string) (bool, error) {
+	tx := r.Connection.Unscoped().Model(&models.Account{}).
+		Where("id = ? and user_id = ? and deleted_at is not null", id, userID).
+		Updates(map[string]interface{}{
+			"deleted_at": nil,
+			"version":    gorm.Expr("version + 1"),
+			"updated_at": time.Now(),
+		})
+	if tx.Error != nil {
+		logger.Error.Println(tx.Error)
+		return false, tx.Error
+	}
+
+	return tx.RowsAffected == 1, nil
+}
+
+// CreateTransaction сохраняет операцию и меняет баланс счета на delta в одной
+// транзакции БД: если счет успели закрыть, операция тоже не сохраняется
+func (r *Repository) CreateTransaction(tr *models.Transaction, delta float64) error {
+	err := r.Connection.Transaction(func(tx *gorm.DB) error {
+		err := tx.Omit("created_at", "updated_at", "deleted_at").Create(&tr).Error
+		if err != nil {
+			return err
+		}
+
+		return changeBalance(tx, tr.AccountID, delta)
+	})
 	if err != nil {
 		logger.Error.Println(err)
 		return err
@@ -144,7 +275,7 @@ func (r *Repository) GetTransactionById(id string) (tr models.Transaction, err e
 }
 
 func (r *Repository) GetAccountInfoById(accountID string) (acc *models.Account, err error) {
-	err = r.Connection.Where("id = ?", accountID).Find(&acc).Error
+	err = r.Connection.Unscoped().Where("id = ?", accountID).Find(&acc).Error
 	if err != nil {
 		logger.Error.Println(err)
 		return nil, err
@@ -153,19 +284,22 @@ func (r *Repository) GetAccountInfoById(accountID string) (acc *models.Account,
 	return acc, nil
 }
 
-func (r *Repository) GetReports(report *models.Report) (tr []models.Transaction, err error) {
-	query := r.Connection
-
-	fmt.Println(report, "====================================")
+// GetReports возвращает операции только по счетам пользователя userID
+func (r *Repository) GetReports(userID string, report *models.Report) (tr []models.Transaction, err error) {
+	query := r.Connection.Model(&models.Transaction{}).Select("transactions.*").
+		Joins("join accounts on accounts.id = transactions.account_id").
+		Where("accounts.user_id = ?", userID)
 
-	if report.Type != "" {
-		query = query.Where("type = ?", report.Type)
+	if report.Type == models.TransactionTransfer {
+		query = query.Where("transactions.type in ?", []string{models.TransactionTransferOut, models.TransactionTransferIn})
+	} else if report.Type != "" {
+		query = query.Where("transactions.type = ?", report.Type)
 	}
 	if report.From != (time.Time{}) {
-		query = query.Where("created_at >= ?", report.From)
+		query = query.Where("transactions.created_at >= ?", report.From)
 	}
 	if report.To != (time.Time{}) {
-		query = query.Where("created_at <= ?", report.To)
+		query = query.Where("transactions.created_at <= ?", report.To)
 	}
 
 	page := 1
@@ -199,3 +333,72 @@ func (r *Repository) GetUserInfoById(userID string) (u *models.User, err error)
 
 	return u, nil
 }
+
+func (r *Repository) GetUserByEmail(email string) (*models.User, error) {
+	var users []models.User
+
+	err := r.Connection.Where("lower(email) = lower(?)", email).Limit(1).Find(&users).Error
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	return &users[0], nil
+}
+
+func (r *Repository) UpdatePassword(userID, hash string) error {
+	err := r.Connection.Model(&models.User{}).Where("id = ?", userID).
+		Updates(map[string]interface{}{"password": hash, "password_unset": false, "updated_at": time.Now()}).Error
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *Repository) UpdateUser(userID string, fields map[string]interface{}) error {
+	err := r.Connection.Model(&models.User{}).Where("id = ?", userID).Updates(fields).Error
+	if err != nil {
+		logger.Error.Println(err)
+		return userUniqueError(err)
+	}
+
+	return nil
+}
+
+// userUniqueError превращает нарушение уникальных индексов users в ошибку для клиента.
+// Так одновременные регистрации с одним именем или почтой не создают дубликатов.
+func userUniqueError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != uniqueViolation {
+		return err
+	}
+	if pgErr.ConstraintName == "users_email_key" {
+		return apperror.ErrEmailRegistered
+	}
+
+	return apperror.ErrRegistered
+}
+
+// DeleteUser помечает пользователя удаленным и отзывает его API ключи
+func (r *Repository) DeleteUser(userID string) error {
+	err := r.Connection.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("id = ?", userID).Delete(&models.User{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&models.ApiKey{}).Where("user_id = ? and revoked_at is null", userID).
+			Update("revoked_at", time.Now()).Error
+	})
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
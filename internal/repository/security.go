@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+)
+
+func (r *Repository) CreateSecurityEvent(event *models.SecurityEvent) error {
+	err := r.Connection.Omit("created_at").Create(event).Error
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *Repository) GetSecurityEvents(filter *models.SecurityEventFilter) (events []models.SecurityEvent, err error) {
+	query := r.Connection.Model(&models.SecurityEvent{})
+
+	if filter.UserID != "" {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Outcome != "" {
+		query = query.Where("outcome = ?", filter.Outcome)
+	}
+	if filter.IP != "" {
+		query = query.Where("ip = ?", filter.IP)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+
+	page := 1
+	limit := 50
+
+	if filter.Page > 0 {
+		page = filter.Page
+	}
+	if filter.Limit > 0 && filter.Limit <= 100 {
+		limit = filter.Limit
+	}
+
+	err = query.Order("created_at desc").Limit(limit).Offset((page - 1) * limit).Find(&events).Error
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	return events, nil
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+	"gorm.io/gorm"
+	"time"
+)
+
+func (r *Repository) EnableTotp(userID, secret string, codeHashes []string) error {
+	err := r.Connection.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).Where("id = ?", userID).
+			Updates(map[string]interface{}{"totp_secret": secret, "totp_enabled": true}).Error
+		if err != nil {
+			return err
+		}
+
+		return replaceRecoveryCodes(tx, userID, codeHashes)
+	})
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *Repository) DisableTotp(userID string) error {
+	err := r.Connection.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).Where("id = ?", userID).
+			Updates(map[string]interface{}{"totp_secret": nil, "totp_enabled": false}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// UseRecoveryCode помечает код использованным, повторно тот же код не пройдет
+func (r *Repository) UseRecoveryCode(userID, codeHash string) (bool, error) {
+	tx := r.Connection.Model(&models.RecoveryCode{}).
+		Where("user_id = ? and code_hash = ? and used_at is null", userID, codeHash).
+		Update("used_at", time.Now())
+	if tx.Error != nil {
+		logger.Error.Println(tx.Error)
+		return false, tx.Error
+	}
+
+	return tx.RowsAffected == 1, nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID string, codeHashes []string) error {
+	err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	if err != nil {
+		return err
+	}
+
+	codes := make([]models.RecoveryCode, 0, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes = append(codes, models.RecoveryCode{UserID: userID, CodeHash: hash})
+	}
+
+	return tx.Omit("used_at", "created_at").Create(&codes).Error
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+	"gorm.io/gorm"
+	"sort"
+)
+
+// Transfer проводит перевод одной транзакцией БД: обе операции и оба баланса
+// сохраняются вместе или не сохраняется ничего
+func (r *Repository) Transfer(t *models.Transfer) error {
+	err := r.Connection.Transaction(func(tx *gorm.DB) error {
+		return transfer(tx, t)
+	})
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func transfer(tx *gorm.DB, t *models.Transfer) error {
+	legs := []models.Transaction{
+		{
+			AccountID:  t.FromAccountID,
+			Type:       models.TransactionTransferOut,
+			Amount:     t.Amount,
+			Currency:   t.Currency,
+			TransferID: &t.ID,
+		},
+		{
+			AccountID:  t.ToAccountID,
+			Type:       models.TransactionTransferIn,
+			Amount:     t.CreditedAmount,
+			Currency:   t.CreditedCurrency,
+			TransferID: &t.ID,
+		},
+	}
+	err := tx.Omit("created_at", "updated_at", "deleted_at").Create(&legs).Error
+	if err != nil {
+		return err
+	}
+
+	changes := []struct {
+		accountID string
+		delta     float64
+	}{
+		{t.FromAccountID, -t.Amount},
+		{t.ToAccountID, t.CreditedAmount},
+	}
+	// строки счетов блокируются всегда в одном порядке, встречные переводы не взаимоблокируются
+	sort.Slice(changes, func(i, j int) bool { return changes[i].accountID < changes[j].accountID })
+
+	for _, change := range changes {
+		// ErrAccountClosed, если счет закрыли после проверки в сервисе
+		err = changeBalance(tx, change.accountID, change.delta)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+	"time"
+)
+
+func (r *Repository) CreateWebAuthnCredential(credential *models.WebAuthnCredential) error {
+	err := r.Connection.Omit("last_used_at", "created_at").Create(credential).Error
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *Repository) GetWebAuthnCredentials(userID string) (credentials []models.WebAuthnCredential, err error) {
+	err = r.Connection.Where("user_id = ?", userID).Order("created_at").Find(&credentials).Error
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	return credentials, nil
+}
+
+func (r *Repository) TouchWebAuthnCredential(credentialID []byte, signCount uint32, backupState bool) error {
+	err := r.Connection.Model(&models.WebAuthnCredential{}).Where("credential_id = ?", credentialID).
+		Updates(map[string]interface{}{
+			"sign_count":   signCount,
+			"backup_state": backupState,
+			"last_used_at": time.Now(),
+		}).Error
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *Repository) DeleteWebAuthnCredential(userID, id string) (bool, error) {
+	tx := r.Connection.Where("id = ? and user_id = ?", id, userID).Delete(&models.WebAuthnCredential{})
+	if tx.Error != nil {
+		logger.Error.Println(tx.Error)
+		return false, tx.Error
+	}
+
+	return tx.RowsAffected == 1, nil
+}
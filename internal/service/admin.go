@@ -0,0 +1,93 @@
+package service
+
+import (
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+)
+
+func (s *Service) SearchUsers(filter *models.UserFilter) ([]models.UserInfo, error) {
+	users, err := s.Repository.SearchUsers(filter)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	infos := make([]models.UserInfo, 0, len(users))
+	for i := range users {
+		infos = append(infos, users[i].Info())
+	}
+
+	return infos, nil
+}
+
+func (s *Service) GetUser(userID string) (*models.User, error) {
+	u, err := s.GetUserInfoById(userID)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+	if u == nil || u.ID == "" {
+		return nil, apperror.ErrNotFound
+	}
+
+	return u, nil
+}
+
+// SetUserDisabled блокирует или разблокирует пользователя. При блокировке
+// все его сессии завершаются сразу, API ключи перестают приниматься.
+func (s *Service) SetUserDisabled(userID string, disabled bool) error {
+	ok, err := s.Repository.SetUserDisabled(userID, disabled)
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+	if !ok {
+		return apperror.ErrNotFound
+	}
+
+	if disabled {
+		err = s.RevokeAllSessions(userID)
+		if err != nil {
+			logger.Error.Println(err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetUserRole меняет роль и завершает сессии, чтобы старая роль не осталась в выданных токенах
+func (s *Service) SetUserRole(userID, role string) error {
+	if role != models.RoleUser && role != models.RoleSupport && role != models.RoleAdmin {
+		return apperror.ErrBadRequest
+	}
+
+	ok, err := s.Repository.SetUserRole(userID, role)
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+	if !ok {
+		return apperror.ErrNotFound
+	}
+
+	err = s.RevokeAllSessions(userID)
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *Service) UnlockUser(userID string) error {
+	u, err := s.GetUser(userID)
+	if err != nil {
+		return err
+	}
+
+	s.ResetLoginFailures(u.Username)
+
+	return nil
+}
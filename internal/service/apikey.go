@@ -0,0 +1,121 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+	"strings"
+	"time"
+)
+
+const apiKeyPrefix = "pk_"
+
+// IsApiKey отличает API ключ от JWT по префиксу
+func IsApiKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// CreateApiKey возвращает ключ в открытом виде один раз, в БД хранится только хэш
+func (s *Service) CreateApiKey(userID string, req *models.ApiKeyRequest) (string, *models.ApiKey, error) {
+	if strings.TrimSpace(req.Name) == "" || len(req.Scopes) == 0 || req.ExpiresInDays < 0 {
+		return "", nil, apperror.ErrBadRequest
+	}
+	for _, scope := range req.Scopes {
+		if !models.AllScopes.Has(scope) {
+			return "", nil, apperror.ErrBadRequest
+		}
+	}
+
+	prefix, err := randomToken(6)
+	if err != nil {
+		logger.Error.Println(err)
+		return "", nil, err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		logger.Error.Println(err)
+		return "", nil, err
+	}
+	rawKey := apiKeyPrefix + prefix + "." + secret
+
+	key := &models.ApiKey{
+		UserID:  userID,
+		Name:    strings.TrimSpace(req.Name),
+		Prefix:  apiKeyPrefix + prefix,
+		KeyHash: hashApiKey(rawKey),
+		Scopes:  req.Scopes,
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		key.ExpiresAt = &expiresAt
+	}
+
+	err = s.Repository.CreateApiKey(key)
+	if err != nil {
+		logger.Error.Println(err)
+		return "", nil, err
+	}
+
+	return rawKey, key, nil
+}
+
+func (s *Service) GetApiKeys(userID string) ([]models.ApiKey, error) {
+	keys, err := s.Repository.GetApiKeys(userID)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (s *Service) RevokeApiKey(userID, id string) error {
+	ok, err := s.Repository.RevokeApiKey(userID, id)
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+	if !ok {
+		return apperror.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *Service) AuthenticateApiKey(rawKey string) (*models.ApiKey, *models.User, error) {
+	key, err := s.Repository.GetApiKeyByHash(hashApiKey(rawKey))
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, nil, err
+	}
+	if key == nil {
+		return nil, nil, apperror.ErrUnauthorized
+	}
+	if key.ExpiresAt != nil && key.ExpiresAt.Before(time.Now()) {
+		return nil, nil, apperror.ErrUnauthorized
+	}
+
+	u, err := s.GetUserInfoById(key.UserID)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, nil, err
+	}
+	if u == nil || u.ID == "" || u.DisabledAt != nil {
+		return nil, nil, apperror.ErrUnauthorized
+	}
+
+	err = s.Repository.TouchApiKey(key.ID)
+	if err != nil {
+		logger.Error.Println(err)
+	}
+
+	return key, u, nil
+}
+
+func hashApiKey(rawKey string) string {
+	sum := sha256.Sum256([]byte(rawKey))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-redis/redis"
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+	"github.com/k4zb3k/project/pkg/notifier"
+	"net"
+	"net/url"
+	"time"
+)
+
+// CheckLoginDevice запоминает устройство входа и, если user agent или подсеть
+// пользователю раньше не встречались, отправляет уведомление со ссылкой
+// "это был не я". Возвращает true, если устройство новое.
+func (s *Service) CheckLoginDevice(userID, sessionID string, client models.ClientInfo) bool {
+	uaHash := hashUserAgent(client.UserAgent)
+	ipRange := s.ipRange(client.IP)
+
+	devices, err := s.Repository.GetKnownDevices(userID)
+	if err != nil {
+		logger.Error.Println(err)
+		return false
+	}
+
+	var seenUserAgent, seenRange bool
+	for _, d := range devices {
+		if d.UserAgentHash == uaHash && d.IPRange == ipRange {
+			err = s.Repository.TouchKnownDevice(d.ID)
+			if err != nil {
+				logger.Error.Println(err)
+			}
+			return false
+		}
+		seenUserAgent = seenUserAgent || d.UserAgentHash == uaHash
+		seenRange = seenRange || d.IPRange == ipRange
+	}
+
+	device := &models.KnownDevice{
+		UserID:        userID,
+		UserAgentHash: uaHash,
+		UserAgent:     client.UserAgent,
+		IPRange:       ipRange,
+	}
+	err = s.Repository.CreateKnownDevice(device)
+	if err != nil {
+		logger.Error.Println(err)
+		return false
+	}
+
+	// при первом входе сравнивать не с чем
+	if len(devices) == 0 || (seenUserAgent && seenRange) {
+		return false
+	}
+
+	err = s.notifyNewDevice(userID, sessionID, device, client)
+	if err != nil {
+		logger.Error.Println("failed to notify about new device: ", err)
+	}
+
+	return true
+}
+
+func (s *Service) notifyNewDevice(userID, sessionID string, device *models.KnownDevice, client models.ClientInfo) error {
+	u, err := s.GetUser(userID)
+	if err != nil {
+		return err
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+
+	key := deviceReportKey(token)
+	_, err = s.Redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HMSet(key, map[string]interface{}{
+			"user_id":    userID,
+			"session_id": sessionID,
+			"device_id":  device.ID,
+		})
+		pipe.Expire(key, s.Config.NewDevice.ReportTTL)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	reportURL := s.Config.NewDevice.ReportURL + url.QueryEscape(token)
+	n := notifier.Notification{
+		Event:    models.EventNewDevice,
+		UserID:   u.ID,
+		Username: u.Username,
+		Email:    u.Email,
+		Subject:  "New sign-in to your account",
+		Text: fmt.Sprintf("Hello, %s!\n\n"+
+			"Your account was just signed in to from a new device.\n\n"+
+			"Time: %s\nIP address: %s\nDevice: %s\n\n"+
+			"If this was you, you can ignore this message. If it wasn't, "+
+			"follow the link below to sign the device out and change your password.\n\n%s\n",
+			u.Username, time.Now().UTC().Format(time.RFC1123), client.IP, client.UserAgent, reportURL),
+		Data: map[string]string{
+			"session_id": sessionID,
+			"ip":         client.IP,
+			"user_agent": client.UserAgent,
+			"report_url": reportURL,
+		},
+	}
+
+	// доставка может быть медленной, вход не ждет ее
+	go func() {
+		if err := s.Notifier.Notify(n); err != nil {
+			logger.Error.Println("failed to send new device notification: ", err)
+		}
+	}()
+
+	return nil
+}
+
+// ReportDevice обрабатывает ссылку "это был не я": завершает сессию нового
+// устройства и забывает его, чтобы следующий вход с него снова вызвал уведомление.
+func (s *Service) ReportDevice(token string) (string, error) {
+	if token == "" {
+		return "", apperror.ErrInvalidToken
+	}
+	key := deviceReportKey(token)
+
+	var get *redis.StringStringMapCmd
+	_, err := s.Redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		get = pipe.HGetAll(key)
+		pipe.Del(key)
+		return nil
+	})
+	if err != nil {
+		logger.Error.Println(err)
+		return "", err
+	}
+
+	fields := get.Val()
+	userID := fields["user_id"]
+	if userID == "" {
+		return "", apperror.ErrInvalidToken
+	}
+
+	// сессия могла уже закончиться сама
+	err = s.RevokeSession(userID, fields["session_id"])
+	if err != nil && err != apperror.ErrNotFound {
+		logger.Error.Println(err)
+		return "", err
+	}
+
+	_, err = s.Repository.DeleteKnownDevice(userID, fields["device_id"])
+	if err != nil {
+		logger.Error.Println(err)
+		return "", err
+	}
+
+	return userID, nil
+}
+
+func (s *Service) GetKnownDevices(userID string) ([]models.KnownDevice, error) {
+	devices, err := s.Repository.GetKnownDevices(userID)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+// ipRange возвращает подсеть адреса, например 203.0.113.0/24
+func (s *Service) ipRange(ip string) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ip
+	}
+
+	if v4 := addr.To4(); v4 != nil {
+		mask := net.CIDRMask(s.Config.NewDevice.IPv4Prefix, 32)
+		return fmt.Sprintf("%s/%d", v4.Mask(mask), s.Config.NewDevice.IPv4Prefix)
+	}
+
+	mask := net.CIDRMask(s.Config.NewDevice.IPv6Prefix, 128)
+	return fmt.Sprintf("%s/%d", addr.Mask(mask), s.Config.NewDevice.IPv6Prefix)
+}
+
+func hashUserAgent(userAgent string) string {
+	sum := sha256.Sum256([]byte(userAgent))
+	return hex.EncodeToString(sum[:])
+}
+
+func deviceReportKey(token string) string {
+	return "device_report:" + token
+}
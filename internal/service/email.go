@@ -0,0 +1,121 @@
+package service
+
+import (
+	"fmt"
+	"github.com/go-redis/redis"
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/pkg/logger"
+	"github.com/k4zb3k/project/pkg/mailer"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SendEmailVerification отправляет ссылку для подтверждения текущей почты пользователя.
+// Токен привязан к адресу: если почту успеют сменить, старая ссылка не сработает.
+func (s *Service) SendEmailVerification(userID string) error {
+	u, err := s.GetUser(userID)
+	if err != nil {
+		return err
+	}
+	if u.Email == "" {
+		return apperror.ErrInvalid
+	}
+	if u.EmailVerifiedAt != nil {
+		return apperror.ErrBadRequest
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	key := emailVerifyKey(token)
+	_, err = s.Redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HMSet(key, map[string]interface{}{"user_id": u.ID, "email": u.Email})
+		pipe.Expire(key, s.Config.EmailVerify.TokenTTL)
+		return nil
+	})
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	err = s.Mailer.Send(mailer.Message{
+		To:      u.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hello, %s!\n\n"+
+			"Please confirm your email address by following the link below. It is valid for %s.\n\n%s\n",
+			u.Username, s.Config.EmailVerify.TokenTTL, s.Config.EmailVerify.URL+url.QueryEscape(token)),
+	})
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *Service) VerifyEmail(token string) error {
+	key := emailVerifyKey(token)
+
+	var get *redis.StringStringMapCmd
+	_, err := s.Redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		get = pipe.HGetAll(key)
+		pipe.Del(key)
+		return nil
+	})
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	fields := get.Val()
+	if fields["user_id"] == "" {
+		return apperror.ErrInvalidToken
+	}
+
+	u, err := s.GetUser(fields["user_id"])
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(u.Email, fields["email"]) {
+		return apperror.ErrInvalidToken
+	}
+
+	err = s.Repository.UpdateUser(u.ID, map[string]interface{}{"email_verified_at": time.Now()})
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *Service) ExistsEmail(email string) (bool, error) {
+	exists, err := s.Repository.ExistsEmail(email)
+	if err != nil {
+		logger.Error.Println(err)
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// normalizeEmail оставляет от ввода только сам адрес в нижнем регистре. Иначе строка
+// вида "X <victim@example.com>" прошла бы проверку уникальности мимо lower(email)
+// и сломала бы RCPT при отправке письма.
+func normalizeEmail(raw string) (string, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(raw))
+	if err != nil {
+		return "", apperror.ErrInvalid
+	}
+
+	return strings.ToLower(addr.Address), nil
+}
+
+func emailVerifyKey(token string) string {
+	return "email_verify:" + token
+}
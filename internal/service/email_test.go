@@ -0,0 +1,38 @@
+package service
+
+import (
+	"errors"
+	"github.com/k4zb3k/project/internal/apperror"
+	"testing"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"alice@example.com", "alice@example.com"},
+		{"  Alice@Example.COM ", "alice@example.com"},
+		{"X <Victim@example.com>", "victim@example.com"},
+		{"<bob@example.com>", "bob@example.com"},
+	}
+
+	for _, tt := range tests {
+		got, err := normalizeEmail(tt.in)
+		if err != nil {
+			t.Errorf("normalizeEmail(%q) error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("normalizeEmail(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeEmailInvalid(t *testing.T) {
+	for _, in := range []string{"", "alice", "alice@", "a@b.c, d@e.f"} {
+		if _, err := normalizeEmail(in); !errors.Is(err, apperror.ErrInvalid) {
+			t.Errorf("normalizeEmail(%q) error = %v, want ErrInvalid", in, err)
+		}
+	}
+}
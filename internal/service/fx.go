@@ -0,0 +1,171 @@
+package service
+
+import (
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/currency"
+	"github.com/k4zb3k/project/pkg/fxrate"
+	"github.com/k4zb3k/project/pkg/logger"
+	"math"
+	"time"
+)
+
+// ImportRates загружает курсы из provider в fx_rates. Курсы валют,
+// которых нет в справочнике ISO 4217, пропускаются.
+func (s *Service) ImportRates(provider fxrate.RateProvider) (*models.FxImportResult, error) {
+	rates, err := provider.Rates()
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	result := &models.FxImportResult{Source: provider.Name()}
+
+	var fxRates []models.FxRate
+	for _, rate := range rates {
+		base, quote := currency.Normalize(rate.Base), currency.Normalize(rate.Quote)
+		if !currency.IsValid(base) || !currency.IsValid(quote) {
+			logger.Warn.Printf("skip %s/%s rate from %s: unknown currency", rate.Base, rate.Quote, provider.Name())
+			continue
+		}
+
+		fxRates = append(fxRates, models.FxRate{
+			Date:   rate.Date,
+			Base:   base,
+			Quote:  quote,
+			Rate:   rate.Rate,
+			Source: provider.Name(),
+		})
+	}
+	if len(fxRates) == 0 {
+		return result, nil
+	}
+
+	err = s.Repository.SaveFxRates(fxRates)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+	result.Imported = len(fxRates)
+
+	logger.Info.Printf("imported %d fx rates from %s", result.Imported, result.Source)
+	return result, nil
+}
+
+// ImportRatesFile импортирует курсы из файла ECB, указанного в конфигурации
+func (s *Service) ImportRatesFile() (*models.FxImportResult, error) {
+	if s.Config.FxRates.File == "" {
+		return nil, apperror.ErrBadRequest.WithDetails(map[string]string{"reason": "fx rates file is not configured"})
+	}
+
+	return s.ImportRates(fxrate.NewFileProvider(s.Config.FxRates.File))
+}
+
+// Convert пересчитывает сумму из одной валюты в другую по курсу на дату date
+func (s *Service) Convert(amount float64, from, to string, date time.Time) (float64, error) {
+	return s.newConverter().Convert(amount, from, to, date)
+}
+
+// GetTotals считает доходы и расходы по всем счетам пользователя в валюте code.
+// Каждая операция пересчитывается по курсу на дату ее совершения.
+func (s *Service) GetTotals(userID, code string, from, to time.Time) (*models.Totals, error) {
+	transactions, err := s.Repository.GetUserTransactions(userID, from, to)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	totals := &models.Totals{Currency: code}
+	converter := s.newConverter()
+	for _, tr := range transactions {
+		// переводы между своими счетами не меняют доходы и расходы
+		if tr.Type != "income" && tr.Type != "expense" {
+			continue
+		}
+
+		amount, err := converter.Convert(tr.Amount, tr.Currency, code, tr.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if tr.Type == "income" {
+			totals.Income += amount
+		} else {
+			totals.Expense += amount
+		}
+	}
+
+	totals.Income = roundAmount(totals.Income)
+	totals.Expense = roundAmount(totals.Expense)
+	totals.Net = roundAmount(totals.Income - totals.Expense)
+
+	return totals, nil
+}
+
+// rateConverter пересчитывает суммы через базовую валюту курсов (кросс-курс).
+// Найденные курсы запоминаются, чтобы отчет не ходил в БД за каждой операцией.
+type rateConverter struct {
+	base   string
+	maxAge time.Duration
+	lookup func(base, quote string, date, since time.Time) (*models.FxRate, error)
+	rates  map[string]float64
+}
+
+func (s *Service) newConverter() *rateConverter {
+	return &rateConverter{
+		base:   s.Config.FxRates.Base,
+		maxAge: s.Config.FxRates.MaxAge,
+		lookup: s.Repository.GetFxRate,
+		rates:  make(map[string]float64),
+	}
+}
+
+func (c *rateConverter) Convert(amount float64, from, to string, date time.Time) (float64, error) {
+	if from == to {
+		return amount, nil
+	}
+
+	fromRate, err := c.rate(from, date)
+	if err != nil {
+		return 0, err
+	}
+	toRate, err := c.rate(to, date)
+	if err != nil {
+		return 0, err
+	}
+
+	return amount / fromRate * toRate, nil
+}
+
+// rate возвращает курс base/code на день date (UTC) или ближайший предыдущий
+func (c *rateConverter) rate(code string, date time.Time) (float64, error) {
+	if code == c.base {
+		return 1, nil
+	}
+
+	day := date.UTC().Truncate(24 * time.Hour)
+	key := code + ":" + day.Format("2006-01-02")
+	if rate, ok := c.rates[key]; ok {
+		return rate, nil
+	}
+
+	fxRate, err := c.lookup(c.base, code, day, day.Add(-c.maxAge))
+	if err != nil {
+		logger.Error.Println(err)
+		return 0, err
+	}
+	if fxRate == nil {
+		return 0, apperror.ErrRateNotFound.WithDetails(map[string]string{
+			"currency": code,
+			"date":     day.Format("2006-01-02"),
+		})
+	}
+
+	c.rates[key] = fxRate.Rate
+	return fxRate.Rate, nil
+}
+
+// roundAmount округляет сумму до копеек после пересчета
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
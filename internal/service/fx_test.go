@@ -0,0 +1,112 @@
+package service
+
+import (
+	"errors"
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/internal/models"
+	"math"
+	"testing"
+	"time"
+)
+
+// fakeRates повторяет запрос Repository.GetFxRate: последний курс не позже date и не раньше since
+type fakeRates struct {
+	rates []models.FxRate
+	calls int
+}
+
+func (f *fakeRates) lookup(base, quote string, date, since time.Time) (*models.FxRate, error) {
+	f.calls++
+
+	var found *models.FxRate
+	for i, r := range f.rates {
+		if r.Base != base || r.Quote != quote || r.Date.After(date) || r.Date.Before(since) {
+			continue
+		}
+		if found == nil || r.Date.After(found.Date) {
+			found = &f.rates[i]
+		}
+	}
+
+	return found, nil
+}
+
+func testDate(value string) time.Time {
+	d, _ := time.Parse("2006-01-02", value)
+	return d
+}
+
+func TestRateConverterUsesPreviousBusinessDay(t *testing.T) {
+	store := &fakeRates{rates: []models.FxRate{
+		{Date: testDate("2024-01-04"), Base: "EUR", Quote: "USD", Rate: 1.0953},
+		{Date: testDate("2024-01-05"), Base: "EUR", Quote: "USD", Rate: 1.0921},
+		{Date: testDate("2024-01-05"), Base: "EUR", Quote: "JPY", Rate: 158.16},
+		{Date: testDate("2024-01-08"), Base: "EUR", Quote: "USD", Rate: 1.0945},
+	}}
+	c := &rateConverter{base: "EUR", maxAge: 7 * 24 * time.Hour, lookup: store.lookup, rates: map[string]float64{}}
+
+	// суббота 6 января: ECB курсы не публикует, берется пятница 5 января
+	saturday := time.Date(2024, 1, 6, 15, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		amount   float64
+		from, to string
+		date     time.Time
+		want     float64
+	}{
+		{"same currency", 100, "USD", "USD", saturday, 100},
+		{"from base", 100, "EUR", "USD", saturday, 109.21},
+		{"to base", 109.21, "USD", "EUR", saturday, 100},
+		{"cross rate", 100, "USD", "JPY", saturday, 100 / 1.0921 * 158.16},
+		{"rate of the transaction date", 100, "EUR", "USD", time.Date(2024, 1, 4, 23, 0, 0, 0, time.UTC), 109.53},
+		{"later rate is not used", 100, "EUR", "USD", time.Date(2024, 1, 7, 12, 0, 0, 0, time.UTC), 109.21},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Convert(tt.amount, tt.from, tt.to, tt.date)
+			if err != nil {
+				t.Fatalf("Convert: %v", err)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Convert = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// курс USD на 6 января уже найден, повторный пересчет не обращается к хранилищу
+	calls := store.calls
+	if _, err := c.Convert(1, "USD", "EUR", saturday.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if store.calls != calls {
+		t.Errorf("rate was looked up again, calls %d -> %d", calls, store.calls)
+	}
+}
+
+func TestRateConverterRateNotFound(t *testing.T) {
+	store := &fakeRates{rates: []models.FxRate{
+		{Date: testDate("2024-01-05"), Base: "EUR", Quote: "USD", Rate: 1.0921},
+	}}
+	c := &rateConverter{base: "EUR", maxAge: 7 * 24 * time.Hour, lookup: store.lookup, rates: map[string]float64{}}
+
+	tests := []struct {
+		name string
+		code string
+		date time.Time
+	}{
+		{"unknown currency", "GBP", testDate("2024-01-05")},
+		{"rate older than max age", "USD", testDate("2024-01-20")},
+		{"no rate before the date", "USD", testDate("2024-01-01")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := c.Convert(100, "EUR", tt.code, tt.date)
+			if !errors.Is(err, apperror.ErrRateNotFound) {
+				t.Errorf("Convert error = %v, want ErrRateNotFound", err)
+			}
+		})
+	}
+}
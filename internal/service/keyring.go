@@ -0,0 +1,230 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/k4zb3k/project/config"
+	"github.com/k4zb3k/project/internal/models"
+	"math/big"
+	"os"
+)
+
+const defaultKid = "default"
+
+// KeyRing хранит ключи подписи JWT. Первым ключом подписываются новые токены,
+// остальные используются только для проверки, пока выданные ими токены не истекут.
+type KeyRing struct {
+	signingKid string
+	order      []string
+	keys       map[string]*signingKey
+}
+
+type signingKey struct {
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+func NewKeyRing(keys []config.JWTKey, secret string) (*KeyRing, error) {
+	if secret != "" {
+		keys = append(keys, config.JWTKey{Kid: defaultKid, Secret: secret})
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no jwt signing keys configured")
+	}
+
+	kr := &KeyRing{
+		signingKid: keys[0].Kid,
+		keys:       make(map[string]*signingKey, len(keys)),
+	}
+	for _, key := range keys {
+		if key.Kid == "" {
+			return nil, fmt.Errorf("jwt key must have kid")
+		}
+		if _, ok := kr.keys[key.Kid]; ok {
+			return nil, fmt.Errorf("duplicate jwt kid %q", key.Kid)
+		}
+
+		sk, err := loadSigningKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q: %w", key.Kid, err)
+		}
+		kr.keys[key.Kid] = sk
+		kr.order = append(kr.order, key.Kid)
+	}
+
+	if kr.keys[kr.signingKid].signKey == nil {
+		return nil, fmt.Errorf("jwt key %q has no private key and can not sign", kr.signingKid)
+	}
+
+	return kr, nil
+}
+
+func loadSigningKey(key config.JWTKey) (*signingKey, error) {
+	if key.Algorithm == "" {
+		key.Algorithm = jwt.SigningMethodHS256.Alg()
+	}
+
+	method := jwt.GetSigningMethod(key.Algorithm)
+	if method == nil {
+		return nil, fmt.Errorf("unsupported algorithm %q", key.Algorithm)
+	}
+
+	if _, ok := method.(*jwt.SigningMethodHMAC); ok {
+		if key.Secret == "" {
+			return nil, fmt.Errorf("secret is required for %s", key.Algorithm)
+		}
+		return &signingKey{method: method, signKey: []byte(key.Secret), verifyKey: []byte(key.Secret)}, nil
+	}
+
+	sk := &signingKey{method: method}
+	switch {
+	case key.PrivateKeyFile != "":
+		private, err := readPrivateKey(key.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		sk.signKey = private
+		sk.verifyKey = private.Public()
+	case key.PublicKeyFile != "":
+		public, err := readPublicKey(key.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		sk.verifyKey = public
+	default:
+		return nil, fmt.Errorf("private_key_file or public_key_file is required for %s", key.Algorithm)
+	}
+
+	switch method.(type) {
+	case *jwt.SigningMethodRSA:
+		if _, ok := sk.verifyKey.(*rsa.PublicKey); !ok {
+			return nil, fmt.Errorf("%s requires an RSA key", key.Algorithm)
+		}
+	case *SigningMethodEdDSA:
+		if _, ok := sk.verifyKey.(ed25519.PublicKey); !ok {
+			return nil, fmt.Errorf("%s requires an Ed25519 key", key.Algorithm)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", key.Algorithm)
+	}
+
+	return sk, nil
+}
+
+func readPrivateKey(path string) (crypto.Signer, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+
+	return signer, nil
+}
+
+func readPublicKey(path string) (crypto.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+
+	return block, nil
+}
+
+func (kr *KeyRing) Sign(claims jwt.MapClaims) (string, error) {
+	key := kr.keys[kr.signingKid]
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = kr.signingKid
+
+	return token.SignedString(key.signKey)
+}
+
+// Keyfunc подбирает ключ проверки по заголовку kid
+func (kr *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		// токены, выданные до появления kid, подписаны ключом по умолчанию
+		kid = defaultKid
+	}
+
+	key, ok := kr.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown jwt kid %q", kid)
+	}
+
+	// алгоритм берем из конфигурации ключа, а не из токена
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.verifyKey, nil
+}
+
+// JWKS возвращает открытые ключи для проверки токенов другими сервисами.
+// HMAC ключи не публикуются.
+func (kr *KeyRing) JWKS() models.JWKSet {
+	set := models.JWKSet{Keys: []models.JWK{}}
+
+	for _, kid := range kr.order {
+		key := kr.keys[kid]
+
+		jwk := models.JWK{
+			Kid: kid,
+			Use: "sig",
+			Alg: key.method.Alg(),
+		}
+		switch public := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"fmt"
+	"github.com/go-redis/redis"
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+	"github.com/k4zb3k/project/pkg/mailer"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// CheckLoginAllowed вызывается до проверки пароля. Если вход сейчас запрещен,
+// возвращает ошибку и время, через которое можно повторить попытку.
+func (s *Service) CheckLoginAllowed(username, ip string) (time.Duration, error) {
+	username = lockoutName(username)
+	for _, key := range []string{loginLockKey("user", username), loginLockKey("ip", ip)} {
+		ttl, err := s.Redis.TTL(key).Result()
+		if err != nil {
+			logger.Error.Println(err)
+			return 0, err
+		}
+		if ttl > 0 {
+			return ttl, apperror.ErrAccountLocked
+		}
+	}
+
+	ttl, err := s.Redis.TTL(loginDelayKey(username)).Result()
+	if err != nil {
+		logger.Error.Println(err)
+		return 0, err
+	}
+	if ttl > 0 {
+		return ttl, apperror.ErrTooManyLogins
+	}
+
+	return 0, nil
+}
+
+// RegisterLoginFailure увеличивает счетчики неудачных попыток. Каждая следующая
+// неудача удваивает паузу, после порога вход блокируется на LockoutDuration.
+func (s *Service) RegisterLoginFailure(username, ip string) (time.Duration, error) {
+	cfg := s.Config.LoginLimit
+	username = lockoutName(username)
+
+	ipFailures, err := s.incrFailures(loginFailuresKey("ip", ip))
+	if err != nil {
+		return 0, err
+	}
+	if ipFailures >= int64(cfg.MaxIPFailures) {
+		logger.Warn.Printf("too many failed logins from ip %s, locking for %s", ip, cfg.LockoutDuration)
+		err = s.Redis.Set(loginLockKey("ip", ip), 1, cfg.LockoutDuration).Err()
+		if err != nil {
+			logger.Error.Println(err)
+			return 0, err
+		}
+		return cfg.LockoutDuration, apperror.ErrAccountLocked
+	}
+
+	failures, err := s.incrFailures(loginFailuresKey("user", username))
+	if err != nil {
+		return 0, err
+	}
+	if failures >= int64(cfg.MaxFailures) {
+		logger.Warn.Printf("too many failed logins for user %s, locking for %s", username, cfg.LockoutDuration)
+		err = s.Redis.Set(loginLockKey("user", username), 1, cfg.LockoutDuration).Err()
+		if err != nil {
+			logger.Error.Println(err)
+			return 0, err
+		}
+		return cfg.LockoutDuration, apperror.ErrAccountLocked
+	}
+
+	delay := cfg.BaseDelay << uint(failures-1)
+	if delay > cfg.LockoutDuration {
+		delay = cfg.LockoutDuration
+	}
+	err = s.Redis.Set(loginDelayKey(username), 1, delay).Err()
+	if err != nil {
+		logger.Error.Println(err)
+		return 0, err
+	}
+
+	return delay, nil
+}
+
+func (s *Service) ResetLoginFailures(username string) {
+	username = lockoutName(username)
+	err := s.Redis.Del(loginFailuresKey("user", username), loginDelayKey(username), loginLockKey("user", username)).Err()
+	if err != nil {
+		logger.Error.Println(err)
+	}
+}
+
+// UnlockAccount снимает блокировку досрочно, если пользователь подтвердил
+// личность вторым фактором или одноразовой ссылкой из письма
+func (s *Service) UnlockAccount(req *models.UnlockRequest) error {
+	if req.Token != "" {
+		return s.unlockByToken(req.Token)
+	}
+
+	attempts, err := s.incrFailures("unlock_attempts:" + lockoutName(req.Username))
+	if err != nil {
+		return err
+	}
+	if attempts > maxChallengeAttempts {
+		return apperror.ErrTooManyLogins
+	}
+
+	u, err := s.Repository.CheckUser(&models.User{Username: req.Username})
+	if err != nil {
+		logger.Error.Println(err)
+		return apperror.ErrUnauthorized
+	}
+	if u == nil || u.ID == "" {
+		return apperror.ErrUnauthorized
+	}
+
+	err = s.VerifySecondFactor(u, req.Code, req.RecoveryCode)
+	if err != nil {
+		return err
+	}
+
+	s.ResetLoginFailures(req.Username)
+	s.Redis.Del("unlock_attempts:" + lockoutName(req.Username))
+
+	return nil
+}
+
+// RequestUnlockEmail отправляет ссылку для снятия блокировки на подтвержденную почту.
+// Как и при сбросе пароля, ответ не зависит от того, существует ли пользователь.
+func (s *Service) RequestUnlockEmail(username string) error {
+	// не больше maxChallengeAttempts писем за окно, чтобы не заваливать почту пользователя
+	sent, err := s.incrFailures("unlock_email:" + lockoutName(username))
+	if err != nil {
+		return err
+	}
+	if sent > maxChallengeAttempts {
+		return apperror.ErrTooManyLogins
+	}
+
+	u, err := s.Repository.CheckUser(&models.User{Username: username})
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+	if u == nil || u.ID == "" || u.EmailVerifiedAt == nil {
+		logger.Info.Println("unlock link requested for unknown user or unverified email")
+		return nil
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	cfg := s.Config.LoginLimit
+	err = s.Redis.Set(unlockTokenKey(token), u.Username, cfg.UnlockTokenTTL).Err()
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	err = s.Mailer.Send(mailer.Message{
+		To:      u.Email,
+		Subject: "Unlock your account",
+		Body: fmt.Sprintf("Hello, %s!\n\n"+
+			"Your account was temporarily locked after several failed sign-in attempts.\n"+
+			"To unlock it now follow the link below. It is valid for %s and can be used once.\n\n%s\n\n"+
+			"If these attempts were not yours, consider changing your password.\n",
+			u.Username, cfg.UnlockTokenTTL, cfg.UnlockURL+url.QueryEscape(token)),
+	})
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *Service) unlockByToken(token string) error {
+	// получение и удаление в одной транзакции, ссылку нельзя использовать дважды
+	var get *redis.StringCmd
+	_, err := s.Redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		get = pipe.Get(unlockTokenKey(token))
+		pipe.Del(unlockTokenKey(token))
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	username, err := get.Result()
+	if err == redis.Nil {
+		return apperror.ErrInvalidToken
+	}
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	s.ResetLoginFailures(username)
+	s.Redis.Del("unlock_attempts:" + lockoutName(username))
+
+	return nil
+}
+
+func (s *Service) incrFailures(key string) (int64, error) {
+	failures, err := s.Redis.Incr(key).Result()
+	if err != nil {
+		logger.Error.Println(err)
+		return 0, err
+	}
+	if failures == 1 {
+		s.Redis.Expire(key, s.Config.LoginLimit.FailureWindow)
+	}
+
+	return failures, nil
+}
+
+// lockoutName приводит имя к виду, в котором хранятся счетчики. Пользователь ищется
+// по lower(username), поэтому "alice" и "Alice" должны делить один лимит попыток.
+func lockoutName(username string) string {
+	return strings.ToLower(username)
+}
+
+func loginFailuresKey(kind, value string) string {
+	return "login_failures:" + kind + ":" + value
+}
+
+func loginLockKey(kind, value string) string {
+	return "login_lock:" + kind + ":" + value
+}
+
+func unlockTokenKey(token string) string {
+	return "unlock:" + token
+}
+
+func loginDelayKey(username string) string {
+	return "login_delay:user:" + username
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"crypto/rand"
+	"errors"
+	"github.com/go-redis/redis"
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+	"github.com/k4zb3k/project/pkg/oidc"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// StartOidcLogin сохраняет state, nonce и PKCE verifier в Redis и возвращает адрес,
+// на который нужно отправить браузер пользователя, и state для cookie этого браузера.
+func (s *Service) StartOidcLogin() (string, string, error) {
+	if !s.Oidc.Enabled() {
+		return "", "", apperror.ErrNotFound
+	}
+
+	state, err := randomToken(32)
+	if err != nil {
+		logger.Error.Println(err)
+		return "", "", err
+	}
+	nonce, err := randomToken(32)
+	if err != nil {
+		logger.Error.Println(err)
+		return "", "", err
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		logger.Error.Println(err)
+		return "", "", err
+	}
+	verifier := oidc.NewVerifier(raw)
+
+	authURL, err := s.Oidc.AuthCodeURL(state, nonce, verifier)
+	if err != nil {
+		logger.Error.Println(err)
+		return "", "", err
+	}
+
+	key := oidcStateKey(state)
+	_, err = s.Redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HMSet(key, map[string]interface{}{"nonce": nonce, "verifier": verifier})
+		pipe.Expire(key, s.Config.Oidc.StateTTL)
+		return nil
+	})
+	if err != nil {
+		logger.Error.Println(err)
+		return "", "", err
+	}
+
+	return authURL, state, nil
+}
+
+// CompleteOidcLogin проверяет ответ провайдера и возвращает ID локального пользователя
+func (s *Service) CompleteOidcLogin(state, code string) (string, error) {
+	if !s.Oidc.Enabled() {
+		return "", apperror.ErrNotFound
+	}
+	if state == "" || code == "" {
+		return "", apperror.ErrBadRequest
+	}
+
+	// state одноразовый
+	key := oidcStateKey(state)
+	var get *redis.StringStringMapCmd
+	_, err := s.Redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		get = pipe.HGetAll(key)
+		pipe.Del(key)
+		return nil
+	})
+	if err != nil {
+		logger.Error.Println(err)
+		return "", err
+	}
+
+	fields := get.Val()
+	if fields["verifier"] == "" {
+		return "", apperror.ErrInvalidToken
+	}
+
+	claims, err := s.Oidc.Exchange(code, fields["verifier"], fields["nonce"])
+	if err != nil {
+		logger.Error.Println(err)
+		if errors.Is(err, oidc.ErrInvalidIDToken) {
+			return "", apperror.ErrInvalidToken
+		}
+		return "", apperror.ErrUnauthorized
+	}
+
+	return s.linkOidcUser(claims)
+}
+
+// linkOidcUser находит пользователя по внешней учетной записи. При первом входе
+// учетная запись привязывается к пользователю с той же подтвержденной почтой
+// или для нее создается новый пользователь.
+func (s *Service) linkOidcUser(claims *oidc.Claims) (string, error) {
+	identity, err := s.Repository.GetUserIdentity(claims.Issuer, claims.Subject)
+	if err != nil {
+		logger.Error.Println(err)
+		return "", err
+	}
+	if identity != nil {
+		return identity.UserID, nil
+	}
+
+	// без подтвержденной провайдером почты не привязываем и не создаем пользователя
+	if claims.Email == "" || !claims.EmailVerified {
+		return "", apperror.ErrEmailUnverified
+	}
+
+	identity = &models.UserIdentity{
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		Email:   claims.Email,
+	}
+
+	u, err := s.Repository.GetUserByEmail(claims.Email)
+	if err != nil {
+		logger.Error.Println(err)
+		return "", err
+	}
+	if u != nil {
+		// иначе владелец почты у провайдера получил бы чужой, не подтвержденный аккаунт
+		if u.EmailVerifiedAt == nil {
+			return "", apperror.ErrEmailRegistered
+		}
+
+		identity.UserID = u.ID
+		err = s.Repository.CreateUserIdentity(identity)
+		if err != nil {
+			logger.Error.Println(err)
+			return "", err
+		}
+
+		return u.ID, nil
+	}
+
+	username, err := s.oidcUsername(claims)
+	if err != nil {
+		return "", err
+	}
+
+	// локальный пароль неизвестен никому, его можно задать через сброс пароля
+	secret, err := randomToken(32)
+	if err != nil {
+		logger.Error.Println(err)
+		return "", err
+	}
+	hash, err := s.hashPassword(secret)
+	if err != nil {
+		logger.Error.Println(err)
+		return "", err
+	}
+
+	now := time.Now()
+	user := &models.User{
+		Username:        username,
+		Email:           claims.Email,
+		EmailVerifiedAt: &now,
+		Password:        hash,
+		PasswordUnset:   true,
+		Role:            models.RoleUser,
+	}
+
+	userID, err := s.Repository.CreateUserWithIdentity(user, identity)
+	if err != nil {
+		logger.Error.Println(err)
+		return "", err
+	}
+
+	return userID, nil
+}
+
+// oidcUsername подбирает свободное имя пользователя из preferred_username или почты
+func (s *Service) oidcUsername(claims *oidc.Claims) (string, error) {
+	base := sanitizeUsername(claims.PreferredUsername)
+	if len(base) < 3 {
+		base = sanitizeUsername(strings.SplitN(claims.Email, "@", 2)[0])
+	}
+	if len(base) < 3 {
+		base = "user"
+	}
+	if len(base) > 14 {
+		base = base[:14]
+	}
+
+	username := base
+	for i := 0; i < 5; i++ {
+		exists, err := s.ExistsUser(username)
+		if err != nil {
+			logger.Error.Println(err)
+			return "", err
+		}
+		if !exists {
+			return username, nil
+		}
+
+		n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+		if err != nil {
+			logger.Error.Println(err)
+			return "", err
+		}
+		username = base + "_" + n.String()
+	}
+
+	return "", apperror.ErrRegistered
+}
+
+func sanitizeUsername(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '.' || r == '-' {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+func oidcStateKey(state string) string {
+	return "oidc_state:" + state
+}
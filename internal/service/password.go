@@ -0,0 +1,123 @@
+package service
+
+import (
+	"fmt"
+	"github.com/go-redis/redis"
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+	"github.com/k4zb3k/project/pkg/mailer"
+	"net/url"
+	"strings"
+)
+
+// RequestPasswordReset отправляет письмо со ссылкой для сброса пароля.
+// Если пользователя с такой почтой нет, ошибка не возвращается,
+// чтобы по ответу нельзя было перебирать зарегистрированные адреса.
+func (s *Service) RequestPasswordReset(email string) error {
+	u, err := s.Repository.GetUserByEmail(strings.TrimSpace(email))
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+	if u == nil || u.EmailVerifiedAt == nil {
+		logger.Info.Println("password reset requested for unknown or unverified email")
+		return nil
+	}
+
+	token, err := randomToken(32)
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	err = s.Redis.Set(passwordResetKey(token), u.ID, s.Config.PasswordReset.TokenTTL).Err()
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	err = s.Mailer.Send(mailer.Message{
+		To:      u.Email,
+		Subject: "Password reset",
+		Body: fmt.Sprintf("Hello, %s!\n\n"+
+			"To set a new password follow the link below. It is valid for %s and can be used once.\n\n%s\n\n"+
+			"If you did not request a password reset, ignore this email.\n",
+			u.Username, s.Config.PasswordReset.TokenTTL, s.Config.PasswordReset.URL+url.QueryEscape(token)),
+	})
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// ResetPassword меняет пароль по одноразовому токену и завершает все сессии пользователя.
+// Токен расходуется только после проверки нового пароля: пароль, не прошедший
+// политику, не заставляет запрашивать письмо заново.
+func (s *Service) ResetPassword(req *models.ResetPasswordRequest) (string, error) {
+	userID, err := s.Redis.Get(passwordResetKey(req.Token)).Result()
+	if err == redis.Nil {
+		return "", apperror.ErrInvalidToken
+	}
+	if err != nil {
+		logger.Error.Println(err)
+		return "", err
+	}
+
+	u, err := s.GetUserInfoById(userID)
+	if err != nil {
+		logger.Error.Println(err)
+		return "", err
+	}
+
+	err = s.ValidatePassword(u.Username, req.Password)
+	if err != nil {
+		return userID, err
+	}
+
+	// токен удаляется, только если он все еще указывает на этого пользователя:
+	// из двух параллельных запросов пароль сменит только один
+	consumed, err := compareAndDelete.Run(s.Redis, []string{passwordResetKey(req.Token)}, userID).Int64()
+	if err != nil {
+		logger.Error.Println(err)
+		return "", err
+	}
+	if consumed == 0 {
+		return "", apperror.ErrInvalidToken
+	}
+
+	hash, err := s.hashPassword(req.Password)
+	if err != nil {
+		logger.Error.Println(err)
+		return "", err
+	}
+
+	err = s.Repository.UpdatePassword(userID, hash)
+	if err != nil {
+		logger.Error.Println(err)
+		return "", err
+	}
+
+	err = s.RevokeAllSessions(userID)
+	if err != nil {
+		logger.Error.Println(err)
+		return "", err
+	}
+	s.ResetLoginFailures(u.Username)
+
+	return userID, nil
+}
+
+// compareAndDelete удаляет ключ, только если его значение равно ARGV[1]
+var compareAndDelete = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`)
+
+func passwordResetKey(token string) string {
+	return "password_reset:" + token
+}
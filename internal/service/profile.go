@@ -0,0 +1,233 @@
+package service
+
+import (
+	"fmt"
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+	"github.com/k4zb3k/project/pkg/notifier"
+	"strings"
+	"time"
+)
+
+// UpdateProfile меняет имя и почту. Смена почты открывает сброс пароля на новый адрес,
+// поэтому требует текущего пароля или недавнего step-up, а старый адрес получает уведомление.
+func (s *Service) UpdateProfile(userID, sessionID string, req *models.ProfileUpdate) (*models.User, error) {
+	u, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]interface{}{}
+	if req.Username != nil {
+		username := strings.TrimSpace(*req.Username)
+		if len(username) > 20 || len(username) < 3 {
+			return nil, apperror.ErrInvalid
+		}
+
+		// имена уникальны без учета регистра: смена регистра своего имени не конфликтует
+		if !strings.EqualFold(username, u.Username) {
+			exists, err := s.ExistsUser(username)
+			if err != nil {
+				logger.Error.Println(err)
+				return nil, err
+			}
+			if exists {
+				return nil, apperror.ErrRegistered
+			}
+		}
+
+		if username != u.Username {
+			fields["username"] = username
+			u.Username = username
+		}
+	}
+
+	oldEmail := u.Email
+	if req.Email != nil {
+		email, err := normalizeEmail(*req.Email)
+		if err != nil {
+			return nil, err
+		}
+
+		// тот же адрес в другом регистре сменой почты не считается
+		if !strings.EqualFold(email, u.Email) {
+			err = s.checkReauthentication(u, sessionID, req.CurrentPassword)
+			if err != nil {
+				return nil, err
+			}
+
+			exists, err := s.ExistsEmail(email)
+			if err != nil {
+				logger.Error.Println(err)
+				return nil, err
+			}
+			if exists {
+				return nil, apperror.ErrEmailRegistered
+			}
+
+			// новый адрес нужно подтвердить заново
+			fields["email"] = email
+			fields["email_verified_at"] = nil
+			u.Email = email
+			u.EmailVerifiedAt = nil
+		}
+	}
+
+	if len(fields) == 0 {
+		return u, nil
+	}
+
+	err = s.Repository.UpdateUser(userID, fields)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	if _, ok := fields["email"]; ok {
+		err = s.SendEmailVerification(userID)
+		if err != nil {
+			logger.Error.Println("failed to send email verification: ", err)
+		}
+		s.notifyEmailChanged(u, oldEmail)
+	}
+
+	return u, nil
+}
+
+// checkReauthentication принимает текущий пароль или недавний step-up сессии.
+// Пользователи OIDC своего пароля не знают, им доступен только step-up.
+func (s *Service) checkReauthentication(u *models.User, sessionID, password string) error {
+	if password != "" && !u.PasswordUnset {
+		err := checkPassword(u.Password, password)
+		if err != nil {
+			logger.Error.Println(err)
+			return apperror.ErrUnauthorized
+		}
+		return nil
+	}
+
+	ok, err := s.hasRecentStepUp(sessionID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return s.stepUpRequired(u)
+	}
+
+	return nil
+}
+
+// checkCurrentPassword требует текущий пароль. Пользователи OIDC (PasswordUnset)
+// своего пароля не знают, вместо него им нужен недавний step-up сессии. Без TOTP
+// и passkey подтвердить сессию нечем, тогда пароль сначала задается через сброс.
+func (s *Service) checkCurrentPassword(u *models.User, sessionID, password string) error {
+	if u.PasswordUnset {
+		return s.checkReauthentication(u, sessionID, "")
+	}
+
+	err := checkPassword(u.Password, password)
+	if err != nil {
+		logger.Error.Println(err)
+		return apperror.ErrUnauthorized
+	}
+
+	return nil
+}
+
+// notifyEmailChanged предупреждает старый адрес: если почту сменил не владелец,
+// он узнает об этом, пока злоумышленник не сбросил пароль через новый адрес
+func (s *Service) notifyEmailChanged(u *models.User, oldEmail string) {
+	if oldEmail == "" {
+		return
+	}
+
+	n := notifier.Notification{
+		Event:    models.EventEmailChange,
+		UserID:   u.ID,
+		Username: u.Username,
+		Email:    oldEmail,
+		Subject:  "Your email address was changed",
+		Text: fmt.Sprintf("Hello, %s!\n\n"+
+			"The email address of your account was changed to %s at %s.\n\n"+
+			"If you did not do this, contact support immediately: "+
+			"whoever changed it can now reset your password.\n",
+			u.Username, u.Email, time.Now().UTC().Format(time.RFC1123)),
+		Data: map[string]string{
+			"old_email": oldEmail,
+			"new_email": u.Email,
+		},
+	}
+
+	go func() {
+		if err := s.Notifier.Notify(n); err != nil {
+			logger.Error.Println("failed to send email change notification: ", err)
+		}
+	}()
+}
+
+// ChangePassword меняет пароль и завершает все сессии, кроме текущей
+func (s *Service) ChangePassword(userID, sessionID string, req *models.ChangePasswordRequest) error {
+	u, err := s.GetUser(userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.checkCurrentPassword(u, sessionID, req.CurrentPassword)
+	if err != nil {
+		return err
+	}
+
+	err = s.ValidatePassword(u.Username, req.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	hash, err := s.hashPassword(req.NewPassword)
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	err = s.Repository.UpdatePassword(userID, hash)
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	err = s.RevokeOtherSessions(userID, sessionID)
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteUser мягко удаляет пользователя: строка остается в БД с deleted_at,
+// войти под ним больше нельзя
+func (s *Service) DeleteUser(userID, sessionID, password string) error {
+	u, err := s.GetUser(userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.checkCurrentPassword(u, sessionID, password)
+	if err != nil {
+		return err
+	}
+
+	err = s.Repository.DeleteUser(userID)
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	err = s.RevokeAllSessions(userID)
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
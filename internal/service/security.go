@@ -0,0 +1,33 @@
+package service
+
+import (
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+)
+
+// RecordSecurityEvent пишет событие в журнал безопасности. Ошибка записи
+// только логируется: журнал не должен ломать вход или другие операции.
+func (s *Service) RecordSecurityEvent(event *models.SecurityEvent) {
+	// неудачный вход знает только имя пользователя, событие привязывается к нему, если он существует
+	if event.UserID == nil && event.Details["username"] != "" {
+		u, err := s.Repository.CheckUser(&models.User{Username: event.Details["username"]})
+		if err == nil && u != nil && u.ID != "" {
+			event.UserID = &u.ID
+		}
+	}
+
+	err := s.Repository.CreateSecurityEvent(event)
+	if err != nil {
+		logger.Error.Println("failed to record security event: ", err)
+	}
+}
+
+func (s *Service) GetSecurityEvents(filter *models.SecurityEventFilter) ([]models.SecurityEvent, error) {
+	events, err := s.Repository.GetSecurityEvents(filter)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	return events, nil
+}
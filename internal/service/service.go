@@ -2,84 +2,85 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/go-redis/redis"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/k4zb3k/project/config"
 	"github.com/k4zb3k/project/internal/apperror"
 	"github.com/k4zb3k/project/internal/models"
 	"github.com/k4zb3k/project/internal/repository"
+	"github.com/k4zb3k/project/pkg/currency"
 	"github.com/k4zb3k/project/pkg/logger"
+	"github.com/k4zb3k/project/pkg/mailer"
+	"github.com/k4zb3k/project/pkg/notifier"
+	"github.com/k4zb3k/project/pkg/oidc"
+	"github.com/k4zb3k/project/pkg/password"
 	"github.com/twinj/uuid"
 	"github.com/xuri/excelize/v2"
-	"golang.org/x/crypto/bcrypt"
-	"os"
 	"strconv"
 	"strings"
 	"time"
 )
 
 type Service struct {
-	Repository *repository.Repository
-	Redis      *redis.Client
+	Repository     *repository.Repository
+	Redis          *redis.Client
+	Config         *config.Config
+	AccessKeys     *KeyRing
+	RefreshKeys    *KeyRing
+	Mailer         mailer.Mailer
+	PasswordPolicy *password.Policy
+	Oidc           *oidc.Provider
+	WebAuthn       *webauthn.WebAuthn
+	Notifier       notifier.Notifier
 }
 
-func NewService(repository *repository.Repository, redis *redis.Client) *Service {
+func NewService(repository *repository.Repository, redis *redis.Client, cfg *config.Config, accessKeys, refreshKeys *KeyRing,
+	mailer mailer.Mailer, passwordPolicy *password.Policy, oidcProvider *oidc.Provider,
+	webAuthn *webauthn.WebAuthn, notifier notifier.Notifier) *Service {
 	return &Service{
-		Repository: repository,
-		Redis:      redis,
+		Repository:     repository,
+		Redis:          redis,
+		Config:         cfg,
+		AccessKeys:     accessKeys,
+		RefreshKeys:    refreshKeys,
+		Mailer:         mailer,
+		PasswordPolicy: passwordPolicy,
+		Oidc:           oidcProvider,
+		WebAuthn:       webAuthn,
+		Notifier:       notifier,
 	}
 }
 
 // ===========================================
 
+// ValidateUser проверяет данные регистрации и приводит почту к виду, в котором она хранится
 func (s *Service) ValidateUser(user *models.User) error {
-	if len(user.Username) > 20 || len(user.Username) < 3 {
-		logger.Error.Println(apperror.ErrForbidden)
-		return apperror.ErrForbidden
-	}
-	if len(user.Password) > 20 || len(user.Password) < 6 {
-		logger.Error.Println(apperror.ErrForbidden)
-		return apperror.ErrForbidden
-	}
-	if strings.Contains(user.Password, "_") || strings.Contains(user.Password, "-") {
-		logger.Error.Println(apperror.ErrForbidden)
-		return apperror.ErrForbidden
-	}
-	if strings.Contains(user.Password, "@") || strings.Contains(user.Password, "#") {
-		logger.Error.Println(apperror.ErrForbidden)
-		return apperror.ErrForbidden
-	}
-	if strings.Contains(user.Password, "$") || strings.Contains(user.Password, "%") {
-		logger.Error.Println(apperror.ErrForbidden)
-		return apperror.ErrForbidden
-	}
-	if strings.Contains(user.Password, "&") || strings.Contains(user.Password, "*") {
-		logger.Error.Println(apperror.ErrForbidden)
-		return apperror.ErrForbidden
-	}
-	if strings.Contains(user.Password, "(") || strings.Contains(user.Password, ")") {
-		logger.Error.Println(apperror.ErrForbidden)
-		return apperror.ErrForbidden
-	}
-	if strings.Contains(user.Password, ":") || strings.Contains(user.Password, ".") {
-		logger.Error.Println(apperror.ErrForbidden)
-		return apperror.ErrForbidden
-	}
-	if strings.Contains(user.Password, "/") || strings.Contains(user.Password, `\`) {
-		logger.Error.Println(apperror.ErrForbidden)
-		return apperror.ErrForbidden
-	}
-	if strings.Contains(user.Password, ",") || strings.Contains(user.Password, ";") {
-		logger.Error.Println(apperror.ErrForbidden)
-		return apperror.ErrForbidden
+	email, err := normalizeEmail(user.Email)
+	if err != nil {
+		logger.Error.Println(err)
+		return err
 	}
-	if strings.Contains(user.Password, "?") || strings.Contains(user.Password, `"`) {
-		logger.Error.Println(apperror.ErrForbidden)
-		return apperror.ErrForbidden
+	user.Email = email
+
+	if len(user.Username) > 20 || len(user.Username) < 3 {
+		logger.Error.Println(apperror.ErrInvalid)
+		return apperror.ErrInvalid
 	}
-	if strings.Contains(user.Password, "!") || strings.Contains(user.Password, "~") {
-		logger.Error.Println(apperror.ErrForbidden)
-		return apperror.ErrForbidden
+
+	return s.ValidatePassword(user.Username, user.Password)
+}
+
+// ValidatePassword проверяет пароль по настроенной политике и перечисляет все нарушенные правила
+func (s *Service) ValidatePassword(username, password string) error {
+	violations := s.PasswordPolicy.Validate(username, password)
+	if len(violations) > 0 {
+		logger.Error.Println(apperror.ErrWeakPassword)
+		return apperror.ErrWeakPassword.WithDetails(violations)
 	}
+
 	return nil
 }
 
@@ -98,13 +99,14 @@ func (s *Service) ExistsUser(username string) (bool, error) {
 }
 
 func (s *Service) CreateUser(ctx context.Context, user *models.User) (string, error) {
-	hashPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	hash, err := s.hashPassword(user.Password)
 	if err != nil {
 		logger.Error.Println("failed to generate hash from password due error: ", err)
 		return "", err
 	}
 
-	user.Password = string(hashPassword)
+	user.Password = hash
+	user.Role = models.RoleUser
 
 	userID, err := s.Repository.CreateUser(ctx, user)
 	if err != nil {
@@ -112,6 +114,12 @@ func (s *Service) CreateUser(ctx context.Context, user *models.User) (string, er
 		return "", err
 	}
 
+	// письмо можно запросить повторно, поэтому ошибка отправки не отменяет регистрацию
+	err = s.SendEmailVerification(userID)
+	if err != nil {
+		logger.Error.Println("failed to send email verification: ", err)
+	}
+
 	return userID, nil
 }
 
@@ -121,53 +129,80 @@ func (s *Service) CheckUser(user *models.User) (string, error) {
 		logger.Error.Println(err)
 		return "", err
 	}
+	// удаленные пользователи отфильтрованы gorm по deleted_at
+	if u == nil || u.ID == "" {
+		return "", apperror.ErrNotFound
+	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(user.Password))
+	err = checkPassword(u.Password, user.Password)
 	if err != nil {
 		logger.Error.Println(err)
 		return "", err
 	}
 
+	// пароль верный: переводим хэш на текущий алгоритм и параметры
+	if password.NeedsRehash(u.Password, s.hashParams()) {
+		hash, err := s.hashPassword(user.Password)
+		if err != nil {
+			logger.Error.Println(err)
+			return u.ID, nil
+		}
+		err = s.Repository.UpdatePassword(u.ID, hash)
+		if err != nil {
+			logger.Error.Println(err)
+		}
+	}
+
 	return u.ID, nil
 }
 
-func (s *Service) CreateToken(userID string) (*models.TokenDetails, error) {
-	td := &models.TokenDetails{}
+// CreateToken выпускает пару токенов для сессии sessionID, пустой sessionID открывает новую сессию
+func (s *Service) CreateToken(userID, sessionID string) (*models.TokenDetails, error) {
+	td := &models.TokenDetails{UserID: userID}
+
+	// роль читается из БД при каждом выпуске токенов, в том числе при refresh
+	u, err := s.GetUserInfoById(userID)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil || u.ID == "" {
+		return nil, apperror.ErrUnauthorized
+	}
+	if u.DisabledAt != nil {
+		return nil, apperror.ErrUserDisabled
+	}
+
+	if sessionID == "" {
+		sessionID = uuid.NewV4().String()
+	}
+	td.SessionID = sessionID
 
 	td.AtExpires = time.Now().Add(time.Minute * 15).Unix()
 	td.AccessUuid = uuid.NewV4().String()
 
 	td.RtExpires = time.Now().Add(time.Hour * 24 * 7).Unix()
-	td.RefreshUuid = uuid.NewV4().String()
+	td.RefreshUuid = refreshUuidFor(td.AccessUuid, userID)
 
 	// Creating Access Token
-	err := os.Setenv("ACCESS_SECRET", "secret")
-	if err != nil {
-		return nil, err
-	}
-
 	atClaims := jwt.MapClaims{}
 	atClaims["authorized"] = true
 	atClaims["access_uuid"] = td.AccessUuid
 	atClaims["user_id"] = userID
+	atClaims["role"] = u.Role
+	atClaims["sid"] = td.SessionID
 	atClaims["exp"] = td.AtExpires
-	at := jwt.NewWithClaims(jwt.SigningMethodHS256, atClaims)
-	td.AccessToken, err = at.SignedString([]byte(os.Getenv("ACCESS_SECRET")))
+	td.AccessToken, err = s.AccessKeys.Sign(atClaims)
 	if err != nil {
 		return nil, err
 	}
 
 	// Creating Refresh Token
-	err = os.Setenv("REFRESH_SECRET", "secret")
-	if err != nil {
-		return nil, err
-	}
 	rtClaims := jwt.MapClaims{}
 	rtClaims["refresh_uuid"] = td.RefreshUuid
 	rtClaims["user_id"] = userID
+	rtClaims["sid"] = td.SessionID
 	rtClaims["exp"] = td.RtExpires
-	rt := jwt.NewWithClaims(jwt.SigningMethodHS256, rtClaims)
-	td.RefreshToken, err = rt.SignedString([]byte(os.Getenv("ACCESS_SECRET")))
+	td.RefreshToken, err = s.RefreshKeys.Sign(rtClaims)
 	if err != nil {
 		return nil, err
 	}
@@ -175,7 +210,7 @@ func (s *Service) CreateToken(userID string) (*models.TokenDetails, error) {
 	return td, nil
 }
 
-func (s *Service) CreateAuth(userID string, td *models.TokenDetails) error {
+func (s *Service) CreateAuth(userID string, td *models.TokenDetails, client models.ClientInfo) error {
 	at := time.Unix(td.AtExpires, 0) // converting Unix to UTC(to Time object)
 	rt := time.Unix(td.RtExpires, 0)
 	now := time.Now()
@@ -191,9 +226,237 @@ func (s *Service) CreateAuth(userID string, td *models.TokenDetails) error {
 		return errRefresh
 	}
 
+	err := s.saveSession(userID, td, client, rt)
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *Service) FetchAuth(ad *models.AccessDetails) (*models.User, error) {
+	userID, err := s.Redis.Get(ad.AccessUuid).Result()
+	if err == redis.Nil {
+		return nil, apperror.ErrUnauthorized
+	}
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+	if userID != ad.UserId {
+		return nil, apperror.ErrUnauthorized
+	}
+
+	// пользователь мог быть удален или заблокирован после выдачи токена
+	u, err := s.GetUserInfoById(userID)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+	if u == nil || u.ID == "" || u.DisabledAt != nil {
+		return nil, apperror.ErrUnauthorized
+	}
+
+	if ad.SessionId != "" {
+		s.touchSession(ad.SessionId)
+	}
+
+	return u, nil
+}
+
+// DeleteAuth завершает сессию, к которой относится access токен
+func (s *Service) DeleteAuth(ad *models.AccessDetails) error {
+	if ad.SessionId != "" {
+		return s.RevokeSession(ad.UserId, ad.SessionId)
+	}
+
+	// токены, выданные до появления сессий
+	refreshUuid := refreshUuidFor(ad.AccessUuid, ad.UserId)
+
+	err := s.Redis.Del(ad.AccessUuid, refreshUuid).Err()
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	err = s.Redis.SRem(userSessionsKey(ad.UserId), ad.AccessUuid, refreshUuid).Err()
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *Service) RefreshToken(refreshToken string, client models.ClientInfo) (*models.TokenDetails, error) {
+	token, err := jwt.Parse(refreshToken, s.RefreshKeys.Keyfunc)
+	if err != nil {
+		logger.Error.Println(err)
+		if vErr, ok := err.(*jwt.ValidationError); ok && vErr.Errors&jwt.ValidationErrorExpired != 0 {
+			return nil, apperror.ErrExpiredRefresh
+		}
+		return nil, apperror.ErrInvalidToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, apperror.ErrInvalidToken
+	}
+	refreshUuid, ok := claims["refresh_uuid"].(string)
+	if !ok {
+		return nil, apperror.ErrInvalidToken
+	}
+	userID, ok := claims["user_id"].(string)
+	if !ok {
+		return nil, apperror.ErrInvalidToken
+	}
+	sessionID, _ := claims["sid"].(string)
+
+	// удаление атомарно: из двух одновременных запросов с одним токеном пройдет только один
+	deleted, err := s.Redis.Del(refreshUuid).Result()
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+	if deleted == 0 {
+		reused, err := s.Redis.Exists(rotatedRefreshKey(refreshUuid)).Result()
+		if err != nil {
+			logger.Error.Println(err)
+			return nil, err
+		}
+		if reused == 0 {
+			return nil, apperror.ErrUnauthorized
+		}
+
+		logger.Warn.Printf("refresh token %s reused, revoking all sessions of user %s", refreshUuid, userID)
+		err = s.RevokeAllSessions(userID)
+		if err != nil {
+			logger.Error.Println(err)
+			return nil, err
+		}
+		return nil, apperror.ErrTokenReused
+	}
+
+	if exp, ok := claims["exp"].(float64); ok {
+		err = s.Redis.Set(rotatedRefreshKey(refreshUuid), userID, time.Until(time.Unix(int64(exp), 0))).Err()
+		if err != nil {
+			logger.Error.Println(err)
+			return nil, err
+		}
+	}
+
+	// старый access токен сессии больше не нужен
+	if sessionID != "" {
+		oldAccessUuid, err := s.Redis.HGet(sessionKey(sessionID), "access_uuid").Result()
+		if err == nil {
+			s.Redis.Del(oldAccessUuid)
+		}
+	}
+
+	td, err := s.CreateToken(userID, sessionID)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	err = s.CreateAuth(userID, td, client)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	return td, nil
+}
+
+func (s *Service) RevokeAllSessions(userID string) error {
+	sessionsKey := userSessionsKey(userID)
+
+	members, err := s.Redis.SMembers(sessionsKey).Result()
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	keys := []string{sessionsKey}
+	for _, member := range members {
+		// в наборе лежат id сессий, а у старых логинов сами uuid токенов
+		keys = append(keys, member, sessionKey(member))
+
+		uuids, err := s.Redis.HMGet(sessionKey(member), "access_uuid", "refresh_uuid").Result()
+		if err != nil {
+			logger.Error.Println(err)
+			return err
+		}
+		for _, v := range uuids {
+			if id, ok := v.(string); ok {
+				keys = append(keys, id)
+			}
+		}
+	}
+
+	err = s.Redis.Del(keys...).Err()
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
 	return nil
 }
 
+func (s *Service) hashPassword(plain string) (string, error) {
+	return password.Hash(plain, s.hashParams())
+}
+
+func (s *Service) hashParams() password.Params {
+	cfg := s.Config.PasswordHash
+
+	return password.Params{
+		Memory:  cfg.MemoryKiB,
+		Time:    cfg.Iterations,
+		Threads: cfg.Parallelism,
+		SaltLen: 16,
+		KeyLen:  32,
+	}
+}
+
+// checkPassword принимает и argon2id, и старые bcrypt хэши
+func checkPassword(hash, plain string) error {
+	ok, err := password.Verify(plain, hash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return apperror.ErrUnauthorized
+	}
+
+	return nil
+}
+
+// randomToken возвращает случайную строку из n байт в base64url
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// refreshUuidFor связывает refresh токен с access токеном той же сессии,
+// чтобы при logout можно было удалить оба
+func refreshUuidFor(accessUuid, userID string) string {
+	return accessUuid + "++" + userID
+}
+
+func userSessionsKey(userID string) string {
+	return "user_sessions:" + userID
+}
+
+func rotatedRefreshKey(refreshUuid string) string {
+	return "rotated_refresh:" + refreshUuid
+}
+
 func (s *Service) ExistsAccount(number string) (bool, error) {
 	existsAccount, err := s.Repository.ExistsAccount(number)
 	if err != nil {
@@ -205,6 +468,14 @@ func (s *Service) ExistsAccount(number string) (bool, error) {
 }
 
 func (s *Service) CreateAccount(account *models.Account) error {
+	account.Currency = currency.Normalize(account.Currency)
+	if account.Currency == "" {
+		account.Currency = s.Config.Accounts.DefaultCurrency
+	}
+	if !currency.IsValid(account.Currency) {
+		return apperror.ErrInvalidCurrency
+	}
+
 	err := s.Repository.CreateAccount(account)
 	if err != nil {
 		logger.Error.Println(err)
@@ -214,8 +485,8 @@ func (s *Service) CreateAccount(account *models.Account) error {
 	return nil
 }
 
-func (s *Service) GetAccounts(userID string) ([]models.Account, error) {
-	accounts, err := s.Repository.GetAccounts(userID)
+func (s *Service) GetAccounts(userID string, includeClosed bool) ([]models.Account, error) {
+	accounts, err := s.Repository.GetAccounts(userID, includeClosed)
 	if err != nil {
 		logger.Error.Println(err)
 		return nil, err
@@ -234,8 +505,82 @@ func (s *Service) GetAccountById(userID, id string) (models.Account, error) {
 	return account, nil
 }
 
-func (s *Service) UpdateAccount(account *models.Account) error {
-	err := s.Repository.UpdateAccount(account)
+// UpdateAccount меняет название, номер и metadata счета. Баланс и владелец
+// через этот метод не меняются.
+func (s *Service) UpdateAccount(userID, id string, req *models.AccountUpdate) (*models.Account, error) {
+	account, err := s.GetAccountById(userID, id)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+	if account.ID == "" {
+		return nil, apperror.ErrNotFound
+	}
+	if account.DeletedAt.Valid {
+		return nil, apperror.ErrAccountClosed
+	}
+	if req.Version <= 0 {
+		return nil, apperror.ErrBadRequest
+	}
+	if req.Version != account.Version {
+		return nil, apperror.ErrVersionConflict.WithDetails(map[string]int{"version": account.Version})
+	}
+
+	fields := map[string]interface{}{}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if len(name) > 100 {
+			return nil, apperror.ErrInvalid
+		}
+		fields["name"] = name
+	}
+
+	if req.Number != nil && *req.Number != account.Number {
+		number := strings.TrimSpace(*req.Number)
+		if number == "" {
+			return nil, apperror.ErrInvalid
+		}
+
+		exists, err := s.ExistsAccount(number)
+		if err != nil {
+			logger.Error.Println(err)
+			return nil, err
+		}
+		if exists {
+			return nil, apperror.ErrExistsAccount
+		}
+		fields["number"] = number
+	}
+
+	if req.Metadata != nil {
+		fields["metadata"] = *req.Metadata
+	}
+
+	if len(fields) == 0 {
+		return &account, nil
+	}
+
+	ok, err := s.Repository.UpdateAccount(userID, id, req.Version, fields)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	updated, err := s.GetAccountById(userID, id)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+	if !ok {
+		return nil, apperror.ErrVersionConflict.WithDetails(map[string]int{"version": updated.Version})
+	}
+
+	return &updated, nil
+}
+
+func (s *Service) CloseAccount(userID, id, transferTo string) error {
+	err := s.Repository.CloseAccount(userID, id, transferTo, uuid.NewV4().String())
 	if err != nil {
 		logger.Error.Println(err)
 		return err
@@ -244,8 +589,45 @@ func (s *Service) UpdateAccount(account *models.Account) error {
 	return nil
 }
 
+func (s *Service) RestoreAccount(userID, id string) error {
+	ok, err := s.Repository.RestoreAccount(userID, id)
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+	if !ok {
+		return apperror.ErrNotFound
+	}
+
+	return nil
+}
+
+// CheckTransactionCurrency подставляет валюту счета, если клиент ее не указал,
+// и отклоняет транзакции в другой валюте
+func (s *Service) CheckTransactionCurrency(account *models.Account, tr *models.Transaction) error {
+	code := currency.Normalize(tr.Currency)
+	if code == "" {
+		code = account.Currency
+	}
+	if !currency.IsValid(code) {
+		return apperror.ErrInvalidCurrency
+	}
+	if code != account.Currency {
+		return apperror.ErrWrongCurrency.WithDetails(map[string]string{"account_currency": account.Currency})
+	}
+
+	tr.Currency = code
+	return nil
+}
+
+// CreateTransaction сохраняет доход или расход вместе с изменением баланса счета
 func (s *Service) CreateTransaction(tr *models.Transaction) error {
-	err := s.Repository.CreateTransaction(tr)
+	delta := tr.Amount
+	if tr.Type == "expense" {
+		delta = -tr.Amount
+	}
+
+	err := s.Repository.CreateTransaction(tr, delta)
 	if err != nil {
 		logger.Error.Println(err)
 		return err
@@ -287,20 +669,20 @@ func (s *Service) GetAccountInfoById(accountID string) (*models.Account, error)
 func (s *Service) GetReports(userID string, report *models.Report) (*excelize.File, error) {
 	var transactions []models.Transaction
 
-	tr, err := s.Repository.GetReports(report)
+	tr, err := s.Repository.GetReports(userID, report)
 	if err != nil {
 		logger.Error.Println(err)
 		return nil, err
 	}
 
-	excelReports, err := s.GetExcelReports(userID, tr)
+	excelReports, err := s.GetExcelReports(userID, tr, report.Currency)
 	if err != nil {
 		logger.Error.Println(err)
 		return nil, err
 	}
 
 	if report == (&models.Report{}) {
-		accounts, err := s.GetAccounts(userID)
+		accounts, err := s.GetAccounts(userID, true)
 		if err != nil {
 			logger.Error.Println(err)
 			return nil, err
@@ -319,7 +701,9 @@ func (s *Service) GetReports(userID string, report *models.Report) (*excelize.Fi
 	return excelReports, nil
 }
 
-func (s *Service) GetExcelReports(userID string, tr []models.Transaction) (*excelize.File, error) {
+// GetExcelReports строит отчет. Если задана валюта code, добавляется колонка
+// с суммой, пересчитанной по курсу на дату операции.
+func (s *Service) GetExcelReports(userID string, tr []models.Transaction, code string) (*excelize.File, error) {
 	excelFile := excelize.NewFile()
 
 	sheet, err := excelFile.NewSheet("Отчёт")
@@ -352,12 +736,27 @@ func (s *Service) GetExcelReports(userID string, tr []models.Transaction) (*exce
 		return nil, err
 	}
 
-	err = excelFile.SetCellValue("Отчёт", "E1", "Дата совершения операции")
+	err = excelFile.SetCellValue("Отчёт", "E1", "Валюта")
 	if err != nil {
 		logger.Error.Println(err)
 		return nil, err
 	}
 
+	err = excelFile.SetCellValue("Отчёт", "F1", "Дата совершения операции")
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	converter := s.newConverter()
+	if code != "" {
+		err = excelFile.SetCellValue("Отчёт", "G1", "Сумма в "+code)
+		if err != nil {
+			logger.Error.Println(err)
+			return nil, err
+		}
+	}
+
 	u, err := s.GetUserInfoById(userID)
 	if err != nil {
 		logger.Error.Println(err)
@@ -396,11 +795,31 @@ func (s *Service) GetExcelReports(userID string, tr []models.Transaction) (*exce
 			return nil, err
 		}
 
-		err = excelFile.SetCellValue("Отчёт", "E"+strconv.Itoa(i), transaction.CreatedAt)
+		err = excelFile.SetCellValue("Отчёт", "E"+strconv.Itoa(i), transaction.Currency)
 		if err != nil {
 			logger.Error.Println(err)
 			return nil, err
 		}
+
+		err = excelFile.SetCellValue("Отчёт", "F"+strconv.Itoa(i), transaction.CreatedAt)
+		if err != nil {
+			logger.Error.Println(err)
+			return nil, err
+		}
+
+		if code != "" {
+			amount, err := converter.Convert(transaction.Amount, transaction.Currency, code, transaction.CreatedAt)
+			if err != nil {
+				logger.Error.Println(err)
+				return nil, err
+			}
+
+			err = excelFile.SetCellValue("Отчёт", "G"+strconv.Itoa(i), roundAmount(amount))
+			if err != nil {
+				logger.Error.Println(err)
+				return nil, err
+			}
+		}
 	}
 	excelFile.SetActiveSheet(sheet)
 
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"github.com/go-redis/redis"
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// saveSession хранит данные об устройстве в hash session:<id>. Сессия живет
+// столько же, сколько ее последний refresh токен.
+func (s *Service) saveSession(userID string, td *models.TokenDetails, client models.ClientInfo, expiresAt time.Time) error {
+	key := sessionKey(td.SessionID)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	err := s.Redis.HSetNX(key, "created_at", now).Err()
+	if err != nil {
+		return err
+	}
+
+	err = s.Redis.HMSet(key, map[string]interface{}{
+		"user_id":      userID,
+		"access_uuid":  td.AccessUuid,
+		"refresh_uuid": td.RefreshUuid,
+		"user_agent":   client.UserAgent,
+		"ip":           client.IP,
+		"last_seen":    now,
+	}).Err()
+	if err != nil {
+		return err
+	}
+
+	err = s.Redis.ExpireAt(key, expiresAt).Err()
+	if err != nil {
+		return err
+	}
+
+	sessionsKey := userSessionsKey(userID)
+	err = s.Redis.SAdd(sessionsKey, td.SessionID).Err()
+	if err != nil {
+		return err
+	}
+
+	return s.Redis.ExpireAt(sessionsKey, expiresAt).Err()
+}
+
+func (s *Service) touchSession(sessionID string) {
+	err := s.Redis.HSet(sessionKey(sessionID), "last_seen", strconv.FormatInt(time.Now().Unix(), 10)).Err()
+	if err != nil {
+		logger.Error.Println(err)
+	}
+}
+
+func (s *Service) GetSessions(userID, currentSessionID string) ([]models.Session, error) {
+	sessionsKey := userSessionsKey(userID)
+
+	ids, err := s.Redis.SMembers(sessionsKey).Result()
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	sessions := []models.Session{}
+	for _, id := range ids {
+		fields, err := s.Redis.HGetAll(sessionKey(id)).Result()
+		if err != nil {
+			logger.Error.Println(err)
+			return nil, err
+		}
+		if fields["user_id"] != userID {
+			// сессия истекла
+			s.Redis.SRem(sessionsKey, id)
+			continue
+		}
+
+		sessions = append(sessions, models.Session{
+			ID:        id,
+			UserAgent: fields["user_agent"],
+			IP:        fields["ip"],
+			CreatedAt: parseUnix(fields["created_at"]),
+			LastSeen:  parseUnix(fields["last_seen"]),
+			Current:   id == currentSessionID,
+		})
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+
+	return sessions, nil
+}
+
+// RevokeSession завершает одну сессию: удаляет ее access и refresh токены
+func (s *Service) RevokeSession(userID, sessionID string) error {
+	key := sessionKey(sessionID)
+
+	fields, err := s.Redis.HMGet(key, "user_id", "access_uuid", "refresh_uuid").Result()
+	if err != nil && err != redis.Nil {
+		logger.Error.Println(err)
+		return err
+	}
+	if owner, _ := fields[0].(string); owner != userID {
+		return apperror.ErrNotFound
+	}
+
+	keys := []string{key}
+	for _, v := range fields[1:] {
+		if id, ok := v.(string); ok {
+			keys = append(keys, id)
+		}
+	}
+
+	err = s.Redis.Del(keys...).Err()
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	err = s.Redis.SRem(userSessionsKey(userID), sessionID).Err()
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *Service) RevokeOtherSessions(userID, keepSessionID string) error {
+	sessionsKey := userSessionsKey(userID)
+
+	members, err := s.Redis.SMembers(sessionsKey).Result()
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	for _, member := range members {
+		if member == keepSessionID {
+			continue
+		}
+
+		err = s.RevokeSession(userID, member)
+		if err == apperror.ErrNotFound {
+			// uuid токена старого логина или уже истекшая сессия
+			s.Redis.Del(member)
+			s.Redis.SRem(sessionsKey, member)
+			continue
+		}
+		if err != nil {
+			logger.Error.Println(err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parseUnix(value string) time.Time {
+	sec, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(sec, 0)
+}
+
+func sessionKey(sessionID string) string {
+	return "session:" + sessionID
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"crypto/sha256"
+	"github.com/go-redis/redis"
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+	"math/bits"
+	"time"
+)
+
+// CreateSignupChallenge выдает одноразовую proof-of-work задачу для регистрации.
+// Сложность сохраняется вместе с задачей, поэтому ее изменение в конфиге
+// не ломает уже выданные задачи.
+func (s *Service) CreateSignupChallenge() (*models.SignupChallenge, error) {
+	challenge, err := randomToken(16)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	cfg := s.Config.Signup
+	err = s.Redis.Set(signupChallengeKey(challenge), cfg.Difficulty, cfg.ChallengeTTL).Err()
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	return &models.SignupChallenge{
+		Challenge:  challenge,
+		Difficulty: cfg.Difficulty,
+		ExpiresIn:  int(cfg.ChallengeTTL.Seconds()),
+	}, nil
+}
+
+// CheckSignupProof проверяет решение задачи. Задача удаляется при первой же
+// проверке, чтобы одно решение нельзя было использовать для нескольких регистраций.
+func (s *Service) CheckSignupProof(challenge, nonce string) error {
+	if s.Config.Signup.Difficulty <= 0 {
+		return nil
+	}
+	if challenge == "" || nonce == "" {
+		return apperror.ErrInvalidProof
+	}
+
+	key := signupChallengeKey(challenge)
+	var get *redis.StringCmd
+	_, err := s.Redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		get = pipe.Get(key)
+		pipe.Del(key)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	difficulty, err := get.Int()
+	if err != nil {
+		return apperror.ErrInvalidProof
+	}
+
+	if leadingZeroBits(sha256.Sum256([]byte(challenge+":"+nonce))) < difficulty {
+		return apperror.ErrInvalidProof
+	}
+
+	return nil
+}
+
+// ReserveSignup занимает место в квоте MaxPerIP регистраций с одного IP за QuotaWindow.
+// Счетчик увеличивается до создания пользователя одним атомарным шагом, поэтому
+// параллельные запросы не превышают квоту. Если регистрация не удалась,
+// место нужно вернуть через ReleaseSignup.
+func (s *Service) ReserveSignup(ip string) (time.Duration, error) {
+	key := signupQuotaKey(ip)
+	cfg := s.Config.Signup
+
+	count, err := incrWithExpire.Run(s.Redis, []string{key}, cfg.QuotaWindow.Milliseconds()).Int64()
+	if err != nil {
+		logger.Error.Println(err)
+		return 0, err
+	}
+	if count <= int64(cfg.MaxPerIP) {
+		return 0, nil
+	}
+
+	s.ReleaseSignup(ip)
+
+	ttl, err := s.Redis.TTL(key).Result()
+	if err != nil {
+		logger.Error.Println(err)
+		return 0, err
+	}
+
+	return ttl, apperror.ErrTooManySignups
+}
+
+// ReleaseSignup возвращает место в квоте. Если окно уже истекло, ключа нет и возвращать
+// нечего: DECR создал бы отрицательный счетчик без срока жизни и навсегда поднял бы квоту IP.
+func (s *Service) ReleaseSignup(ip string) {
+	err := decrIfPositive.Run(s.Redis, []string{signupQuotaKey(ip)}).Err()
+	if err != nil && err != redis.Nil {
+		logger.Error.Println(err)
+	}
+}
+
+// incrWithExpire увеличивает счетчик и при создании ставит ему срок жизни ARGV[1] мс
+var incrWithExpire = redis.NewScript(`
+local n = redis.call("incr", KEYS[1])
+if n == 1 then
+	redis.call("pexpire", KEYS[1], ARGV[1])
+end
+return n
+`)
+
+// decrIfPositive уменьшает существующий счетчик, не опуская его ниже нуля.
+// DECR сохраняет срок жизни ключа.
+var decrIfPositive = redis.NewScript(`
+local n = tonumber(redis.call("get", KEYS[1]))
+if n and n > 0 then
+	return redis.call("decr", KEYS[1])
+end
+return 0
+`)
+
+func leadingZeroBits(sum [sha256.Size]byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+func signupChallengeKey(challenge string) string {
+	return "signup_pow:" + challenge
+}
+
+func signupQuotaKey(ip string) string {
+	return "signup_quota:" + ip
+}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+	"io"
+	"math"
+	"time"
+)
+
+const stepUpEndpoint = "/v1/api/step-up"
+
+// Способы подтверждения, которые перечисляются клиенту в StepUpChallenge
+const (
+	stepUpPassword = "password"
+	stepUpTotp     = "totp"
+	stepUpPasskey  = "passkey"
+)
+
+// StepUp повторно проверяет пароль или TOTP код и на config.StepUp.MaxAge
+// отмечает сессию как недавно подтвержденную. Неудачные попытки идут в те же
+// счетчики, что и вход: перебор пароля или кода по украденному токену блокируется.
+// При блокировке возвращается время, через которое можно повторить попытку.
+func (s *Service) StepUp(userID, sessionID, ip string, req *models.StepUpRequest) (time.Duration, error) {
+	if sessionID == "" {
+		return 0, apperror.ErrForbidden
+	}
+
+	u, err := s.GetUser(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	retryAfter, err := s.CheckLoginAllowed(u.Username, ip)
+	if err != nil {
+		return retryAfter, err
+	}
+
+	switch {
+	case req.Code != "":
+		err = s.VerifySecondFactor(u, req.Code, "")
+	case req.Password != "" && !u.PasswordUnset:
+		err = checkPassword(u.Password, req.Password)
+		if err != nil {
+			logger.Error.Println(err)
+			err = apperror.ErrUnauthorized
+		}
+	default:
+		return 0, apperror.ErrBadRequest
+	}
+	if err != nil {
+		retryAfter, lockErr := s.RegisterLoginFailure(u.Username, ip)
+		if lockErr != nil {
+			return retryAfter, lockErr
+		}
+		return 0, err
+	}
+	s.ResetLoginFailures(u.Username)
+
+	return 0, s.markStepUp(sessionID)
+}
+
+// BeginStepUpPasskey начинает подтверждение сессии passkey пользователя
+func (s *Service) BeginStepUpPasskey(userID, sessionID string) (*protocol.CredentialAssertion, error) {
+	if sessionID == "" {
+		return nil, apperror.ErrForbidden
+	}
+
+	user, err := s.loadWebAuthnUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(user.credentials) == 0 {
+		return nil, apperror.ErrBadRequest
+	}
+
+	assertion, session, err := s.WebAuthn.BeginLogin(user,
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	err = s.saveWebAuthnSession(webAuthnStepUpKey(sessionID), session)
+	if err != nil {
+		return nil, err
+	}
+
+	return assertion, nil
+}
+
+// FinishStepUpPasskey проверяет ответ navigator.credentials.get() и отмечает сессию
+func (s *Service) FinishStepUpPasskey(userID, sessionID string, body io.Reader) error {
+	if sessionID == "" {
+		return apperror.ErrForbidden
+	}
+
+	session, err := s.takeWebAuthnSession(webAuthnStepUpKey(sessionID))
+	if err != nil {
+		return err
+	}
+
+	user, err := s.loadWebAuthnUser(userID)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(body)
+	if err != nil {
+		logger.Error.Println(err)
+		return apperror.ErrBadRequest
+	}
+
+	credential, err := s.WebAuthn.ValidateLogin(user, *session, parsed)
+	if err != nil {
+		logger.Error.Println(err)
+		return apperror.ErrUnauthorized
+	}
+	if credential.Authenticator.CloneWarning {
+		logger.Warn.Printf("passkey of user %s reported sign count regression", userID)
+		return apperror.ErrUnauthorized
+	}
+
+	err = s.Repository.TouchWebAuthnCredential(credential.ID, credential.Authenticator.SignCount, credential.Flags.BackupState)
+	if err != nil {
+		logger.Error.Println(err)
+	}
+
+	return s.markStepUp(sessionID)
+}
+
+// CheckTransactionStepUp требует недавнего подтверждения для операций больше порога.
+// Порог задан в Accounts.DefaultCurrency, сумма в другой валюте пересчитывается по
+// текущему курсу. API ключи подтверждение пройти не могут, поэтому крупные операции им недоступны.
+func (s *Service) CheckTransactionStepUp(userID, sessionID string, amount float64, code string) error {
+	threshold := s.Config.StepUp.TransactionThreshold
+	if threshold <= 0 {
+		return nil
+	}
+
+	amount = math.Abs(amount)
+	if base := s.Config.Accounts.DefaultCurrency; code != "" && code != base {
+		converted, err := s.Convert(amount, code, base, time.Now())
+		if err != nil {
+			// без курса сумму не сравнить с порогом, подтверждение требуется всегда
+			logger.Warn.Printf("step-up threshold: cannot convert %s to %s: %v", code, base, err)
+			converted = math.Inf(1)
+		}
+		amount = converted
+	}
+	if amount <= threshold {
+		return nil
+	}
+
+	ok, err := s.hasRecentStepUp(sessionID)
+	if err != nil || ok {
+		return err
+	}
+
+	u, err := s.GetUser(userID)
+	if err != nil {
+		return err
+	}
+
+	return s.stepUpRequired(u)
+}
+
+func (s *Service) markStepUp(sessionID string) error {
+	err := s.Redis.Set(stepUpKey(sessionID), time.Now().Unix(), s.Config.StepUp.MaxAge).Err()
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// hasRecentStepUp сообщает, подтверждала ли сессия личность за последние StepUp.MaxAge
+func (s *Service) hasRecentStepUp(sessionID string) (bool, error) {
+	if sessionID == "" {
+		return false, nil
+	}
+
+	n, err := s.Redis.Exists(stepUpKey(sessionID)).Result()
+	if err != nil {
+		logger.Error.Println(err)
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// stepUpRequired возвращает ошибку со способами подтверждения, доступными пользователю:
+// пароль есть не у всех (вход через OIDC), passkey - только после регистрации ключа
+func (s *Service) stepUpRequired(u *models.User) error {
+	var methods []string
+	if !u.PasswordUnset {
+		methods = append(methods, stepUpPassword)
+	}
+	if u.TotpEnabled {
+		methods = append(methods, stepUpTotp)
+	}
+
+	credentials, err := s.Repository.GetWebAuthnCredentials(u.ID)
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+	if len(credentials) > 0 {
+		methods = append(methods, stepUpPasskey)
+	}
+
+	return apperror.ErrStepUpRequired.WithDetails(models.StepUpChallenge{
+		Methods:  methods,
+		Endpoint: stepUpEndpoint,
+		MaxAge:   int(s.Config.StepUp.MaxAge.Seconds()),
+	})
+}
+
+func stepUpKey(sessionID string) string {
+	return "step_up:" + sessionID
+}
+
+func webAuthnStepUpKey(sessionID string) string {
+	return "webauthn_step_up:" + sessionID
+}
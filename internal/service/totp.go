@@ -0,0 +1,270 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"github.com/go-redis/redis"
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+	"github.com/k4zb3k/project/pkg/totp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	totpSkew             = 1
+	totpEnrollTTL        = 10 * time.Minute
+	loginChallengeTTL    = 5 * time.Minute
+	maxChallengeAttempts = 5
+)
+
+func (s *Service) StartTotpEnrollment(userID string) (*models.TotpEnrollment, error) {
+	u, err := s.GetUserInfoById(userID)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+	if u.TotpEnabled {
+		return nil, apperror.ErrTotpEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	// секрет сохраняется в БД только после подтверждения первым кодом
+	err = s.Redis.Set(totpEnrollKey(userID), secret, totpEnrollTTL).Err()
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	return &models.TotpEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(s.Config.Totp.Issuer, u.Username, secret),
+	}, nil
+}
+
+// ConfirmTotpEnrollment включает 2FA и возвращает коды восстановления.
+// Коды показываются пользователю один раз, в БД хранятся только их хэши.
+func (s *Service) ConfirmTotpEnrollment(userID, code string) ([]string, error) {
+	secret, err := s.Redis.Get(totpEnrollKey(userID)).Result()
+	if err == redis.Nil {
+		return nil, apperror.ErrInvalidTotp
+	}
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now(), totpSkew)
+	if !ok {
+		return nil, apperror.ErrInvalidTotp
+	}
+
+	codes, hashes, err := generateRecoveryCodes(s.Config.Totp.RecoveryCodes)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	err = s.Repository.EnableTotp(userID, secret, hashes)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	err = s.Redis.Del(totpEnrollKey(userID)).Err()
+	if err != nil {
+		logger.Error.Println(err)
+	}
+	s.markTotpStepUsed(userID, step)
+
+	return codes, nil
+}
+
+func (s *Service) DisableTotp(userID, code string) error {
+	u, err := s.GetUserInfoById(userID)
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+	if !u.TotpEnabled {
+		return apperror.ErrTotpDisabled
+	}
+
+	err = s.VerifySecondFactor(u, code, "")
+	if err != nil {
+		return err
+	}
+
+	err = s.Repository.DisableTotp(userID)
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// CreateLoginChallenge выдается после проверки пароля, если у пользователя включена 2FA.
+// Пара токенов выдается только после CompleteLoginChallenge.
+func (s *Service) CreateLoginChallenge(userID string) (string, error) {
+	challenge, err := randomToken(32)
+	if err != nil {
+		logger.Error.Println(err)
+		return "", err
+	}
+
+	err = s.Redis.Set(loginChallengeKey(challenge), userID, loginChallengeTTL).Err()
+	if err != nil {
+		logger.Error.Println(err)
+		return "", err
+	}
+
+	return challenge, nil
+}
+
+// CompleteLoginChallenge проверяет второй фактор. Неверные коды идут в счетчики
+// блокировки входа: иначе, зная пароль, можно бесконечно получать новые challenge
+// и перебирать код. Счетчики сбрасываются только после успешного второго фактора.
+func (s *Service) CompleteLoginChallenge(req *models.LoginChallenge, ip string) (string, time.Duration, error) {
+	challengeKey := loginChallengeKey(req.ChallengeToken)
+
+	userID, err := s.Redis.Get(challengeKey).Result()
+	if err == redis.Nil {
+		return "", 0, apperror.ErrUnauthorized
+	}
+	if err != nil {
+		logger.Error.Println(err)
+		return "", 0, err
+	}
+
+	attemptsKey := challengeKey + ":attempts"
+	attempts, err := s.Redis.Incr(attemptsKey).Result()
+	if err != nil {
+		logger.Error.Println(err)
+		return "", 0, err
+	}
+	s.Redis.Expire(attemptsKey, loginChallengeTTL)
+	if attempts > maxChallengeAttempts {
+		s.Redis.Del(challengeKey, attemptsKey)
+		return "", 0, apperror.ErrUnauthorized
+	}
+
+	u, err := s.GetUserInfoById(userID)
+	if err != nil {
+		logger.Error.Println(err)
+		return "", 0, err
+	}
+
+	retryAfter, err := s.CheckLoginAllowed(u.Username, ip)
+	if err != nil {
+		s.Redis.Del(challengeKey, attemptsKey)
+		return "", retryAfter, err
+	}
+
+	err = s.VerifySecondFactor(u, req.Code, req.RecoveryCode)
+	if err != nil {
+		retryAfter, lockErr := s.RegisterLoginFailure(u.Username, ip)
+		if lockErr != nil {
+			s.Redis.Del(challengeKey, attemptsKey)
+			return "", retryAfter, lockErr
+		}
+		return "", 0, err
+	}
+	s.ResetLoginFailures(u.Username)
+
+	err = s.Redis.Del(challengeKey, attemptsKey).Err()
+	if err != nil {
+		logger.Error.Println(err)
+		return "", 0, err
+	}
+
+	return userID, 0, nil
+}
+
+// VerifySecondFactor проверяет TOTP код или, если он передан, код восстановления
+func (s *Service) VerifySecondFactor(u *models.User, code, recoveryCode string) error {
+	if !u.TotpEnabled {
+		return apperror.ErrTotpDisabled
+	}
+
+	if recoveryCode != "" {
+		ok, err := s.Repository.UseRecoveryCode(u.ID, hashRecoveryCode(recoveryCode))
+		if err != nil {
+			logger.Error.Println(err)
+			return err
+		}
+		if !ok {
+			return apperror.ErrInvalidTotp
+		}
+		return nil
+	}
+
+	step, ok := totp.Validate(u.TotpSecret, code, time.Now(), totpSkew)
+	if !ok {
+		return apperror.ErrInvalidTotp
+	}
+
+	// один и тот же код нельзя использовать дважды
+	if !s.markTotpStepUsed(u.ID, step) {
+		return apperror.ErrInvalidTotp
+	}
+
+	return nil
+}
+
+func (s *Service) markTotpStepUsed(userID string, step int64) bool {
+	ttl := time.Duration((2*totpSkew+1)*totp.Period) * time.Second
+
+	ok, err := s.Redis.SetNX(totpUsedKey(userID, step), 1, ttl).Result()
+	if err != nil {
+		logger.Error.Println(err)
+		return false
+	}
+
+	return ok
+}
+
+func generateRecoveryCodes(n int) (codes, hashes []string, err error) {
+	for i := 0; i < n; i++ {
+		raw := make([]byte, 5)
+		if _, err = rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(raw))
+		code = code[:4] + "-" + code[4:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func totpEnrollKey(userID string) string {
+	return "totp_enroll:" + userID
+}
+
+func totpUsedKey(userID string, step int64) string {
+	return "totp_used:" + userID + ":" + strconv.FormatInt(step, 10)
+}
+
+func loginChallengeKey(challenge string) string {
+	return "login_challenge:" + challenge
+}
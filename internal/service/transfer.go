@@ -0,0 +1,103 @@
+package service
+
+import (
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+	"github.com/twinj/uuid"
+	"math"
+	"time"
+)
+
+// Transfer переводит деньги между двумя счетами пользователя. Для счетов в разных
+// валютах сумма зачисления считается по курсу из fx_rates или по курсу из запроса,
+// если он близок к курсу fx_rates.
+func (s *Service) Transfer(userID, sessionID string, req *models.TransferRequest) (*models.Transfer, error) {
+	if req.Amount <= 0 || req.Rate < 0 || req.FromAccountID == "" || req.FromAccountID == req.ToAccountID {
+		return nil, apperror.ErrBadRequest
+	}
+
+	from, err := s.transferAccount(userID, req.FromAccountID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.transferAccount(userID, req.ToAccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	// крупные переводы требуют недавнего подтверждения, как и транзакции
+	err = s.CheckTransactionStepUp(userID, sessionID, req.Amount, from.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &models.Transfer{
+		ID:               uuid.NewV4().String(),
+		FromAccountID:    from.ID,
+		ToAccountID:      to.ID,
+		Amount:           roundAmount(req.Amount),
+		Currency:         from.Currency,
+		CreditedCurrency: to.Currency,
+		Rate:             1,
+		CreatedAt:        time.Now(),
+	}
+
+	if from.Currency != to.Currency {
+		t.Rate, err = s.transferRate(from.Currency, to.Currency, req.Rate, t.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+	} else if req.Rate != 0 && req.Rate != 1 {
+		// у счетов одна валюта, курс кроме 1 означает ошибку клиента
+		return nil, apperror.ErrWrongCurrency
+	}
+	t.CreditedAmount = roundAmount(t.Amount * t.Rate)
+	if t.Amount == 0 || t.CreditedAmount == 0 {
+		return nil, apperror.ErrBadRequest
+	}
+
+	err = s.Repository.Transfer(t)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// transferRate возвращает курс перевода. Курс из fx_rates нужен всегда: курс клиента
+// принимается, только если отличается от него не больше чем на FxRates.TransferTolerance,
+// иначе завышенный курс создавал бы деньги на счете зачисления.
+func (s *Service) transferRate(from, to string, requested float64, date time.Time) (float64, error) {
+	reference, err := s.Convert(1, from, to, date)
+	if err != nil {
+		return 0, err
+	}
+	if requested == 0 {
+		return reference, nil
+	}
+
+	if math.Abs(requested-reference)/reference > s.Config.FxRates.TransferTolerance {
+		logger.Warn.Printf("transfer rate %v for %s/%s rejected, reference rate %v", requested, from, to, reference)
+		return 0, apperror.ErrRateMismatch.WithDetails(map[string]float64{"reference_rate": reference})
+	}
+
+	return requested, nil
+}
+
+func (s *Service) transferAccount(userID, id string) (*models.Account, error) {
+	account, err := s.Repository.GetAccountById(userID, id)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+	if account.ID == "" {
+		return nil, apperror.ErrNotFound
+	}
+	if account.DeletedAt.Valid {
+		return nil, apperror.ErrAccountClosed
+	}
+
+	return &account, nil
+}
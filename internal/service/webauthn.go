@@ -0,0 +1,329 @@
+package service
+
+import (
+	"encoding/json"
+	"github.com/go-redis/redis"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/k4zb3k/project/config"
+	"github.com/k4zb3k/project/internal/apperror"
+	"github.com/k4zb3k/project/internal/models"
+	"github.com/k4zb3k/project/pkg/logger"
+	"io"
+	"time"
+)
+
+func NewWebAuthn(cfg config.WebAuthnConfig) (*webauthn.WebAuthn, error) {
+	return webauthn.New(&webauthn.Config{
+		RPID:          cfg.RPID,
+		RPDisplayName: cfg.RPDisplayName,
+		RPOrigins:     cfg.RPOrigins,
+	})
+}
+
+// webAuthnUser связывает models.User и его passkey с интерфейсом webauthn.User
+type webAuthnUser struct {
+	user        *models.User
+	credentials []models.WebAuthnCredential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return []byte(u.user.ID)
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Username
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.Username
+}
+
+func (u *webAuthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.credentials))
+	for _, c := range u.credentials {
+		transports := make([]protocol.AuthenticatorTransport, 0, len(c.Transports))
+		for _, t := range c.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+
+		credentials = append(credentials, webauthn.Credential{
+			ID:              c.CredentialID,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: c.BackupEligible,
+				BackupState:    c.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    c.AAGUID,
+				SignCount: c.SignCount,
+			},
+		})
+	}
+
+	return credentials
+}
+
+func (s *Service) loadWebAuthnUser(userID string) (*webAuthnUser, error) {
+	u, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := s.Repository.GetWebAuthnCredentials(userID)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	return &webAuthnUser{user: u, credentials: credentials}, nil
+}
+
+// BeginPasskeyRegistration возвращает параметры для navigator.credentials.create().
+// Уже зарегистрированные ключи исключаются, чтобы одно устройство не добавили дважды.
+// Passkey - постоянный вход без пароля и TOTP, поэтому сессия должна быть недавно
+// подтверждена: украденного access токена для этого мало. FinishPasskeyRegistration
+// без состояния, сохраненного здесь, не пройдет.
+func (s *Service) BeginPasskeyRegistration(userID, sessionID string) (*protocol.CredentialCreation, error) {
+	user, err := s.loadWebAuthnUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.checkReauthentication(user.user, sessionID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(user.credentials))
+	for _, c := range user.WebAuthnCredentials() {
+		exclusions = append(exclusions, c.Descriptor())
+	}
+
+	creation, session, err := s.WebAuthn.BeginRegistration(user,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	err = s.saveWebAuthnSession(webAuthnRegisterKey(userID), session)
+	if err != nil {
+		return nil, err
+	}
+
+	return creation, nil
+}
+
+func (s *Service) FinishPasskeyRegistration(userID, name string, body io.Reader) (*models.WebAuthnCredential, error) {
+	session, err := s.takeWebAuthnSession(webAuthnRegisterKey(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.loadWebAuthnUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(body)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, apperror.ErrBadRequest
+	}
+
+	credential, err := s.WebAuthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, apperror.ErrUnauthorized
+	}
+
+	transports := make(models.Scopes, 0, len(credential.Transport))
+	for _, t := range credential.Transport {
+		transports = append(transports, string(t))
+	}
+
+	c := &models.WebAuthnCredential{
+		UserID:          userID,
+		Name:            name,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      transports,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	}
+
+	err = s.Repository.CreateWebAuthnCredential(c)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// BeginPasskeyLogin начинает вход без имени пользователя: браузер сам предложит
+// подходящий passkey, а пользователь определяется по userHandle из ответа.
+func (s *Service) BeginPasskeyLogin() (*protocol.CredentialAssertion, error) {
+	// без проверки пользователя (PIN, биометрия) ключ был бы одним фактором в обход TOTP
+	assertion, session, err := s.WebAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	err = s.saveWebAuthnSession(webAuthnLoginKey(session.Challenge), session)
+	if err != nil {
+		return nil, err
+	}
+
+	return assertion, nil
+}
+
+// FinishPasskeyLogin проверяет подпись и возвращает ID пользователя
+func (s *Service) FinishPasskeyLogin(body io.Reader) (string, error) {
+	parsed, err := protocol.ParseCredentialRequestResponseBody(body)
+	if err != nil {
+		logger.Error.Println(err)
+		return "", apperror.ErrBadRequest
+	}
+
+	// challenge из clientDataJSON подписан ключом, поэтому по нему можно искать сессию
+	session, err := s.takeWebAuthnSession(webAuthnLoginKey(parsed.Response.CollectedClientData.Challenge))
+	if err != nil {
+		return "", err
+	}
+
+	var user *webAuthnUser
+	credential, err := s.WebAuthn.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		user, err = s.loadWebAuthnUser(string(userHandle))
+		return user, err
+	}, *session, parsed)
+	if err != nil {
+		logger.Error.Println(err)
+		return "", apperror.ErrUnauthorized
+	}
+
+	// счетчик подписей не вырос - возможно, ключ скопирован
+	if credential.Authenticator.CloneWarning {
+		logger.Warn.Printf("passkey of user %s reported sign count regression", user.user.ID)
+		return "", apperror.ErrUnauthorized
+	}
+	if !credential.Flags.UserVerified {
+		logger.Warn.Printf("passkey login of user %s without user verification", user.user.ID)
+		return "", apperror.ErrUnauthorized
+	}
+
+	err = s.Repository.TouchWebAuthnCredential(credential.ID, credential.Authenticator.SignCount, credential.Flags.BackupState)
+	if err != nil {
+		logger.Error.Println(err)
+	}
+
+	return user.user.ID, nil
+}
+
+func (s *Service) GetPasskeys(userID string) ([]models.WebAuthnCredential, error) {
+	credentials, err := s.Repository.GetWebAuthnCredentials(userID)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	return credentials, nil
+}
+
+// DeletePasskey, как и регистрация, требует недавнего подтверждения сессии
+func (s *Service) DeletePasskey(userID, sessionID, id string) error {
+	u, err := s.GetUser(userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.checkReauthentication(u, sessionID, "")
+	if err != nil {
+		return err
+	}
+
+	ok, err := s.Repository.DeleteWebAuthnCredential(userID, id)
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+	if !ok {
+		return apperror.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *Service) saveWebAuthnSession(key string, session *webauthn.SessionData) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	err = s.Redis.Set(key, data, s.Config.WebAuthn.ChallengeTTL).Err()
+	if err != nil {
+		logger.Error.Println(err)
+		return err
+	}
+
+	return nil
+}
+
+// takeWebAuthnSession получает и удаляет состояние церемонии, challenge одноразовый
+func (s *Service) takeWebAuthnSession(key string) (*webauthn.SessionData, error) {
+	var get *redis.StringCmd
+	_, err := s.Redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		get = pipe.Get(key)
+		pipe.Del(key)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	data, err := get.Bytes()
+	if err == redis.Nil {
+		return nil, apperror.ErrInvalidToken
+	}
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+
+	var session webauthn.SessionData
+	err = json.Unmarshal(data, &session)
+	if err != nil {
+		logger.Error.Println(err)
+		return nil, err
+	}
+	if !session.Expires.IsZero() && session.Expires.Before(time.Now()) {
+		return nil, apperror.ErrInvalidToken
+	}
+
+	return &session, nil
+}
+
+func webAuthnRegisterKey(userID string) string {
+	return "webauthn_register:" + userID
+}
+
+func webAuthnLoginKey(challenge string) string {
+	return "webauthn_login:" + challenge
+}
@@ -0,0 +1,111 @@
+package fxrate
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ECB публикует курсы евро к остальным валютам
+const ecbBase = "EUR"
+
+type ecbEnvelope struct {
+	Cube struct {
+		Days []struct {
+			Time  string `xml:"time,attr"`
+			Rates []struct {
+				Currency string `xml:"currency,attr"`
+				Rate     string `xml:"rate,attr"`
+			} `xml:"Cube"`
+		} `xml:"Cube"`
+	} `xml:"Cube"`
+}
+
+// ParseECBXML разбирает eurofxref-daily.xml, eurofxref-hist.xml и eurofxref-hist-90d.xml
+func ParseECBXML(r io.Reader) ([]Rate, error) {
+	var envelope ecbEnvelope
+	if err := xml.NewDecoder(r).Decode(&envelope); err != nil {
+		return nil, fmt.Errorf("decode ecb xml: %w", err)
+	}
+
+	var rates []Rate
+	for _, day := range envelope.Cube.Days {
+		date, err := time.Parse("2006-01-02", day.Time)
+		if err != nil {
+			return nil, fmt.Errorf("ecb xml: bad date %q", day.Time)
+		}
+
+		for _, r := range day.Rates {
+			value, err := strconv.ParseFloat(r.Rate, 64)
+			if err != nil || value <= 0 {
+				return nil, fmt.Errorf("ecb xml: bad rate %q for %s on %s", r.Rate, r.Currency, day.Time)
+			}
+			rates = append(rates, Rate{Date: date, Base: ecbBase, Quote: r.Currency, Rate: value})
+		}
+	}
+
+	return rates, nil
+}
+
+// ParseECBCSV разбирает eurofxref.csv и eurofxref-hist.csv: первая колонка - дата,
+// остальные - валюты. Пропуски ("N/A" или пустые ячейки) игнорируются.
+func ParseECBCSV(r io.Reader) ([]Rate, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read ecb csv header: %w", err)
+	}
+	if len(header) < 2 || strings.TrimSpace(header[0]) != "Date" {
+		return nil, fmt.Errorf("ecb csv: unexpected header")
+	}
+
+	var rates []Rate
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read ecb csv: %w", err)
+		}
+
+		date, err := parseECBDate(strings.TrimSpace(record[0]))
+		if err != nil {
+			return nil, err
+		}
+
+		for i := 1; i < len(record) && i < len(header); i++ {
+			code := strings.TrimSpace(header[i])
+			value := strings.TrimSpace(record[i])
+			if code == "" || value == "" || value == "N/A" {
+				continue
+			}
+
+			rate, err := strconv.ParseFloat(value, 64)
+			if err != nil || rate <= 0 {
+				return nil, fmt.Errorf("ecb csv: bad rate %q for %s on %s", value, code, record[0])
+			}
+			rates = append(rates, Rate{Date: date, Base: ecbBase, Quote: code, Rate: rate})
+		}
+	}
+
+	return rates, nil
+}
+
+// в исторических файлах дата ISO, в ежедневном - "05 January 2024"
+func parseECBDate(value string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "02 January 2006"} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("ecb csv: bad date %q", value)
+}
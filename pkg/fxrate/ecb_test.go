@@ -0,0 +1,173 @@
+package fxrate
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// фрагменты реальных файлов https://www.ecb.europa.eu/stats/eurofxref/
+const (
+	dailyXML = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<gesmes:Sender>
+		<gesmes:name>European Central Bank</gesmes:name>
+	</gesmes:Sender>
+	<Cube>
+		<Cube time='2024-01-05'>
+			<Cube currency='USD' rate='1.0921'/>
+			<Cube currency='JPY' rate='158.16'/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+	histXML = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<Cube>
+		<Cube time="2024-01-05"><Cube currency="USD" rate="1.0921"/></Cube>
+		<Cube time="2024-01-04"><Cube currency="USD" rate="1.0953"/><Cube currency="GBP" rate="0.86145"/></Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+	// eurofxref.zip: дата словами, пробелы после запятых и пустая колонка в конце
+	dailyCSV = "Date, USD, JPY, \n05 January 2024, 1.0921, 158.16, \n"
+
+	// eurofxref-hist.zip: ISO даты, N/A для валют, которых в этот день не было
+	histCSV = "Date,USD,JPY,CYP,\n" +
+		"2024-01-05,1.0921,158.16,N/A,\n" +
+		"2024-01-04,1.0953,N/A,N/A,\n"
+)
+
+func day(value string) time.Time {
+	d, _ := time.Parse("2006-01-02", value)
+	return d
+}
+
+func TestParseECB(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func(string) ([]Rate, error)
+		input string
+		want  []Rate
+	}{
+		{
+			name:  "daily xml",
+			parse: func(s string) ([]Rate, error) { return ParseECBXML(strings.NewReader(s)) },
+			input: dailyXML,
+			want: []Rate{
+				{Date: day("2024-01-05"), Base: "EUR", Quote: "USD", Rate: 1.0921},
+				{Date: day("2024-01-05"), Base: "EUR", Quote: "JPY", Rate: 158.16},
+			},
+		},
+		{
+			name:  "historical xml",
+			parse: func(s string) ([]Rate, error) { return ParseECBXML(strings.NewReader(s)) },
+			input: histXML,
+			want: []Rate{
+				{Date: day("2024-01-05"), Base: "EUR", Quote: "USD", Rate: 1.0921},
+				{Date: day("2024-01-04"), Base: "EUR", Quote: "USD", Rate: 1.0953},
+				{Date: day("2024-01-04"), Base: "EUR", Quote: "GBP", Rate: 0.86145},
+			},
+		},
+		{
+			name:  "daily csv",
+			parse: func(s string) ([]Rate, error) { return ParseECBCSV(strings.NewReader(s)) },
+			input: dailyCSV,
+			want: []Rate{
+				{Date: day("2024-01-05"), Base: "EUR", Quote: "USD", Rate: 1.0921},
+				{Date: day("2024-01-05"), Base: "EUR", Quote: "JPY", Rate: 158.16},
+			},
+		},
+		{
+			name:  "historical csv",
+			parse: func(s string) ([]Rate, error) { return ParseECBCSV(strings.NewReader(s)) },
+			input: histCSV,
+			want: []Rate{
+				{Date: day("2024-01-05"), Base: "EUR", Quote: "USD", Rate: 1.0921},
+				{Date: day("2024-01-05"), Base: "EUR", Quote: "JPY", Rate: 158.16},
+				{Date: day("2024-01-04"), Base: "EUR", Quote: "USD", Rate: 1.0953},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.parse(tt.input)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseECBErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func(string) ([]Rate, error)
+		input string
+	}{
+		{"xml not an envelope", func(s string) ([]Rate, error) { return ParseECBXML(strings.NewReader(s)) }, "not xml"},
+		{"xml bad date", func(s string) ([]Rate, error) { return ParseECBXML(strings.NewReader(s)) },
+			`<Envelope><Cube><Cube time="05.01.2024"><Cube currency="USD" rate="1.1"/></Cube></Cube></Envelope>`},
+		{"xml bad rate", func(s string) ([]Rate, error) { return ParseECBXML(strings.NewReader(s)) },
+			`<Envelope><Cube><Cube time="2024-01-05"><Cube currency="USD" rate="-1"/></Cube></Cube></Envelope>`},
+		{"csv unexpected header", func(s string) ([]Rate, error) { return ParseECBCSV(strings.NewReader(s)) },
+			"Day,USD\n2024-01-05,1.1\n"},
+		{"csv bad date", func(s string) ([]Rate, error) { return ParseECBCSV(strings.NewReader(s)) },
+			"Date,USD\n01/05/2024,1.1\n"},
+		{"csv bad rate", func(s string) ([]Rate, error) { return ParseECBCSV(strings.NewReader(s)) },
+			"Date,USD\n2024-01-05,abc\n"},
+		{"csv empty", func(s string) ([]Rate, error) { return ParseECBCSV(strings.NewReader(s)) }, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.parse(tt.input); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestFileProvider(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"eurofxref-hist.xml": histXML,
+		"eurofxref-hist.csv": histCSV,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		p := NewFileProvider(path)
+		rates, err := p.Rates()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(rates) != 3 {
+			t.Errorf("%s: got %d rates, want 3", name, len(rates))
+		}
+		if p.Name() != "ecb:"+name {
+			t.Errorf("Name() = %q", p.Name())
+		}
+	}
+
+	path := filepath.Join(dir, "rates.json")
+	if err := os.WriteFile(path, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileProvider(path).Rates(); err == nil {
+		t.Error("expected an error for an unsupported extension")
+	}
+}
@@ -0,0 +1,54 @@
+package fxrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Rate - курс на дату: за 1 единицу Base дают Rate единиц Quote
+type Rate struct {
+	Date  time.Time
+	Base  string
+	Quote string
+	Rate  float64
+}
+
+// RateProvider - источник курсов для импорта. Сейчас курсы читаются из файлов
+// ECB на диске, HTTP источник достаточно реализовать этим же интерфейсом.
+type RateProvider interface {
+	Name() string
+	Rates() ([]Rate, error)
+}
+
+// FileProvider читает справочные курсы ECB (eurofxref) в формате XML или CSV
+type FileProvider struct {
+	path string
+}
+
+func NewFileProvider(path string) *FileProvider {
+	return &FileProvider{path: path}
+}
+
+func (p *FileProvider) Name() string {
+	return "ecb:" + filepath.Base(p.path)
+}
+
+func (p *FileProvider) Rates() ([]Rate, error) {
+	f, err := os.Open(p.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(p.path)) {
+	case ".xml":
+		return ParseECBXML(f)
+	case ".csv":
+		return ParseECBCSV(f)
+	default:
+		return nil, fmt.Errorf("unsupported rates file %q, expected .xml or .csv", p.path)
+	}
+}
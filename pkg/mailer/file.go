@@ -0,0 +1,30 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// FileMailer сохраняет каждое письмо отдельным .eml файлом в каталоге outbox
+type FileMailer struct {
+	from string
+	dir  string
+	seq  uint64
+}
+
+func NewFileMailer(from, dir string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &FileMailer{from: from, dir: dir}, nil
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	name := fmt.Sprintf("%s-%d.eml", time.Now().Format("20060102T150405.000000"), atomic.AddUint64(&m.seq, 1))
+
+	return os.WriteFile(filepath.Join(m.dir, name), format(m.from, msg), 0644)
+}
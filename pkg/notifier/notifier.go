@@ -0,0 +1,58 @@
+package notifier
+
+import (
+	"fmt"
+	"github.com/k4zb3k/project/config"
+	"github.com/k4zb3k/project/pkg/mailer"
+)
+
+// Notification - уведомление пользователя о событии безопасности
+type Notification struct {
+	Event    string
+	UserID   string
+	Username string
+	Email    string
+	Subject  string
+	Text     string
+	Data     map[string]string
+}
+
+// Notifier доставляет уведомления пользователям: письмом через mailer
+// (в разработке это каталог outbox) или POST запросом на webhook.
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+func NewNotifier(cfg config.NotifierConfig, m mailer.Mailer) (Notifier, error) {
+	switch cfg.Driver {
+	case "email":
+		return NewMailNotifier(m), nil
+	case "webhook":
+		if cfg.WebhookURL == "" {
+			return nil, fmt.Errorf("webhook notifier requires webhook_url")
+		}
+		return NewWebhookNotifier(cfg.WebhookURL, cfg.WebhookSecret), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier driver %q", cfg.Driver)
+	}
+}
+
+type MailNotifier struct {
+	mailer mailer.Mailer
+}
+
+func NewMailNotifier(m mailer.Mailer) *MailNotifier {
+	return &MailNotifier{mailer: m}
+}
+
+func (n *MailNotifier) Notify(notification Notification) error {
+	if notification.Email == "" {
+		return fmt.Errorf("user %s has no email", notification.UserID)
+	}
+
+	return n.mailer.Send(mailer.Message{
+		To:      notification.Email,
+		Subject: notification.Subject,
+		Body:    notification.Text,
+	})
+}
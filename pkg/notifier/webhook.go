@@ -0,0 +1,74 @@
+package notifier
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WebhookNotifier отправляет уведомление JSON-ом. Если задан секрет, тело
+// подписывается HMAC-SHA256 в заголовке X-Signature.
+type WebhookNotifier struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+type webhookPayload struct {
+	Event   string            `json:"event"`
+	UserID  string            `json:"user_id"`
+	Subject string            `json:"subject"`
+	Text    string            `json:"text"`
+	Data    map[string]string `json:"data,omitempty"`
+	SentAt  time.Time         `json:"sent_at"`
+}
+
+func NewWebhookNotifier(url, secret string) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:    url,
+		secret: secret,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *WebhookNotifier) Notify(notification Notification) error {
+	body, err := json.Marshal(webhookPayload{
+		Event:   notification.Event,
+		UserID:  notification.UserID,
+		Subject: notification.Subject,
+		Text:    notification.Text,
+		Data:    notification.Data,
+		SentAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.secret != "" {
+		mac := hmac.New(sha256.New, []byte(n.secret))
+		mac.Write(body)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+
+	return nil
+}
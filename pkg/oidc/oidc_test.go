@@ -0,0 +1,273 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/k4zb3k/project/config"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testClientID = "project-client"
+	testCode     = "auth-code"
+	testNonce    = "nonce-123"
+	testKid      = "key-1"
+)
+
+// mockIdP - локальный OpenID провайдер: discovery, JWKS и token endpoint.
+// claims позволяет тесту подменить содержимое id_token.
+type mockIdP struct {
+	server    *httptest.Server
+	issuer    string // issuer в discovery, по умолчанию адрес сервера
+	challenge string
+	claims    func(issuer string) jwt.MapClaims
+	kid       string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &mockIdP{kid: testKid}
+	m.claims = func(issuer string) jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":            issuer,
+			"sub":            "user-42",
+			"aud":            testClientID,
+			"exp":            time.Now().Add(time.Minute).Unix(),
+			"iat":            time.Now().Unix(),
+			"nonce":          testNonce,
+			"email":          "alice@example.com",
+			"email_verified": true,
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer := m.issuer
+		if issuer == "" {
+			issuer = m.server.URL
+		}
+		writeJSON(w, 200, map[string]string{
+			"issuer":                 issuer,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, 200, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": testKid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			writeJSON(w, 400, map[string]string{"error": "invalid_request"})
+			return
+		}
+		if r.PostForm.Get("code") != testCode || r.PostForm.Get("client_id") != testClientID {
+			writeJSON(w, 400, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		// PKCE: verifier должен соответствовать challenge из запроса авторизации
+		if CodeChallenge(r.PostForm.Get("code_verifier")) != m.challenge {
+			writeJSON(w, 400, map[string]string{"error": "invalid_grant", "error_description": "pkce"})
+			return
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, m.claims(m.server.URL))
+		token.Header["kid"] = m.kid
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			writeJSON(w, 500, map[string]string{"error": "server_error"})
+			return
+		}
+		writeJSON(w, 200, map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": idToken})
+	})
+
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+
+	return m
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// authorize проходит шаг авторизации: запоминает challenge из AuthCodeURL
+func (m *mockIdP) authorize(t *testing.T, p *Provider, verifier string) {
+	t.Helper()
+
+	authURL, err := p.AuthCodeURL("state-1", testNonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("state") != "state-1" || q.Get("nonce") != testNonce {
+		t.Fatalf("unexpected authorization request: %s", authURL)
+	}
+	m.challenge = q.Get("code_challenge")
+}
+
+func newTestProvider(m *mockIdP) *Provider {
+	return NewProvider(config.OidcConfig{
+		Enabled:     true,
+		Issuer:      m.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: "http://localhost/callback",
+		Scopes:      []string{"openid", "email"},
+	})
+}
+
+func TestExchange(t *testing.T) {
+	m := newMockIdP(t)
+	p := newTestProvider(m)
+	verifier := NewVerifier([]byte("0123456789abcdef0123456789abcdef"))
+	m.authorize(t, p, verifier)
+
+	claims, err := p.Exchange(testCode, verifier, testNonce)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if claims.Subject != "user-42" || claims.Email != "alice@example.com" || !claims.EmailVerified {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+	if claims.Issuer != m.server.URL {
+		t.Errorf("issuer = %q, want %q", claims.Issuer, m.server.URL)
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	m := newMockIdP(t)
+	p := newTestProvider(m)
+	m.authorize(t, p, NewVerifier([]byte("0123456789abcdef0123456789abcdef")))
+
+	_, err := p.Exchange(testCode, NewVerifier([]byte("another verifier value 123456789")), testNonce)
+	if err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("Exchange error = %v, want token endpoint invalid_grant", err)
+	}
+}
+
+func TestExchangeIDTokenChecks(t *testing.T) {
+	tests := []struct {
+		name   string
+		nonce  string
+		kid    string
+		modify func(c jwt.MapClaims)
+	}{
+		{name: "nonce mismatch", nonce: "other-nonce"},
+		{name: "wrong audience", modify: func(c jwt.MapClaims) { c["aud"] = "someone-else" }},
+		{name: "wrong issuer", modify: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{name: "expired", modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{name: "no exp", modify: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{name: "no sub", modify: func(c jwt.MapClaims) { delete(c, "sub") }},
+		{name: "unknown kid", kid: "key-2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockIdP(t)
+			base := m.claims
+			m.claims = func(issuer string) jwt.MapClaims {
+				c := base(issuer)
+				if tt.modify != nil {
+					tt.modify(c)
+				}
+				return c
+			}
+			if tt.kid != "" {
+				m.kid = tt.kid
+			}
+
+			p := newTestProvider(m)
+			verifier := NewVerifier([]byte("0123456789abcdef0123456789abcdef"))
+			m.authorize(t, p, verifier)
+
+			nonce := testNonce
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+
+			_, err := p.Exchange(testCode, verifier, nonce)
+			if !errors.Is(err, ErrInvalidIDToken) {
+				t.Fatalf("Exchange error = %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+}
+
+func TestExchangeRejectsForeignSignature(t *testing.T) {
+	m := newMockIdP(t)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// id_token подписан чужим ключом с тем же kid
+	m.server.Config.Handler = signWith(m, other)
+
+	p := newTestProvider(m)
+	verifier := NewVerifier([]byte("0123456789abcdef0123456789abcdef"))
+	m.authorize(t, p, verifier)
+
+	_, err = p.Exchange(testCode, verifier, testNonce)
+	if !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("Exchange error = %v, want ErrInvalidIDToken", err)
+	}
+}
+
+// signWith подменяет token endpoint так, чтобы id_token подписывался ключом key,
+// остальные ответы остаются от исходного mock IdP
+func signWith(m *mockIdP, key *rsa.PrivateKey) http.Handler {
+	original := m.server.Config.Handler
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/token" {
+			original.ServeHTTP(w, r)
+			return
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, m.claims(m.server.URL))
+		token.Header["kid"] = testKid
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			writeJSON(w, 500, map[string]string{"error": "server_error"})
+			return
+		}
+		writeJSON(w, 200, map[string]string{"id_token": idToken})
+	})
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	m := newMockIdP(t)
+	m.issuer = "https://evil.example.com"
+	p := newTestProvider(m)
+
+	_, err := p.AuthCodeURL("s", "n", "v")
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("AuthCodeURL error = %v, want issuer mismatch", err)
+	}
+}
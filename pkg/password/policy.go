@@ -0,0 +1,174 @@
+package password
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/k4zb3k/project/config"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Violation описывает одно нарушенное правило политики паролей
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type Policy struct {
+	cfg       config.PasswordPolicyConfig
+	blocklist map[string]struct{}
+}
+
+func NewPolicy(cfg config.PasswordPolicyConfig) (*Policy, error) {
+	p := &Policy{
+		cfg:       cfg,
+		blocklist: map[string]struct{}{},
+	}
+
+	if cfg.BlocklistFile == "" {
+		return p, nil
+	}
+
+	file, err := os.Open(cfg.BlocklistFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.blocklist[strings.ToLower(line)] = struct{}{}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Validate возвращает все нарушенные правила, пустой список - пароль подходит
+func (p *Policy) Validate(username, password string) []Violation {
+	var violations []Violation
+
+	length := utf8.RuneCountInString(password)
+	if length < p.cfg.MinLength {
+		violations = append(violations, Violation{
+			Rule:    "min_length",
+			Message: fmt.Sprintf("password must be at least %d characters long", p.cfg.MinLength),
+		})
+	}
+	if p.cfg.MaxLength > 0 && length > p.cfg.MaxLength {
+		violations = append(violations, Violation{
+			Rule:    "max_length",
+			Message: fmt.Sprintf("password must be at most %d characters long", p.cfg.MaxLength),
+		})
+	}
+
+	if classes := charClasses(password); classes < p.cfg.MinCharClasses {
+		violations = append(violations, Violation{
+			Rule: "char_classes",
+			Message: fmt.Sprintf("password must contain at least %d of: lowercase letters, uppercase letters, digits, symbols",
+				p.cfg.MinCharClasses),
+		})
+	}
+
+	if _, ok := p.blocklist[strings.ToLower(password)]; ok {
+		violations = append(violations, Violation{
+			Rule:    "common_password",
+			Message: "password is too common",
+		})
+	}
+
+	if similar(strings.ToLower(username), strings.ToLower(password)) {
+		violations = append(violations, Violation{
+			Rule:    "similar_to_username",
+			Message: "password is too similar to the username",
+		})
+	}
+
+	return violations
+}
+
+func charClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+
+	return lower + upper + digit + symbol
+}
+
+// similar считает пароль похожим на имя пользователя, если одно содержит
+// другое (в том числе задом наперед) или они отличаются на пару символов
+func similar(username, password string) bool {
+	if len(username) < 3 {
+		return false
+	}
+	if strings.Contains(password, username) || strings.Contains(username, password) {
+		return true
+	}
+	if strings.Contains(password, reverse(username)) {
+		return true
+	}
+
+	return levenshtein(username, password) <= 3
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+
+	return string(runes)
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = minOf(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func minOf(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+
+	return m
+}
@@ -1,12 +1,96 @@
 create table users (
                        id       uuid primary key default gen_random_uuid(),
                        username text not null,
+                       email    text,
+                       email_verified_at timestamptz,
                        password text not null,
+                       -- пароль сгенерирован при входе через OIDC и никому не известен
+                       password_unset boolean not null default false,
+                       totp_secret  text,
+                       totp_enabled boolean not null default false,
+                       role        text not null default 'user' check (role in ('user', 'support', 'admin')),
+                       disabled_at timestamptz,
                        created_at  timestamptz not null default current_timestamp,
                        updated_at  timestamptz,
                        deleted_at  timestamptz
 );
 
+-- имена и почта уникальны без учета регистра среди не удаленных пользователей
+create unique index users_username_key on users (lower(username)) where deleted_at is null;
+create unique index users_email_key on users (lower(email)) where deleted_at is null;
+
+create table user_identities (
+                                 id         uuid primary key default gen_random_uuid(),
+                                 user_id    uuid not null references users on delete cascade,
+                                 issuer     text not null,
+                                 subject    text not null,
+                                 email      text,
+                                 created_at timestamptz not null default current_timestamp,
+                                 unique (issuer, subject)
+);
+
+create table webauthn_credentials (
+                                      id               uuid primary key default gen_random_uuid(),
+                                      user_id          uuid not null references users on delete cascade,
+                                      name             text not null default '',
+                                      credential_id    bytea not null unique,
+                                      public_key       bytea not null,
+                                      attestation_type text not null default '',
+                                      transports       text not null default '',
+                                      aaguid           bytea,
+                                      sign_count       bigint not null default 0,
+                                      backup_eligible  boolean not null default false,
+                                      backup_state     boolean not null default false,
+                                      last_used_at     timestamptz,
+                                      created_at       timestamptz not null default current_timestamp
+);
+
+create table known_devices (
+                               id              uuid primary key default gen_random_uuid(),
+                               user_id         uuid not null references users on delete cascade,
+                               user_agent_hash text not null,
+                               user_agent      text not null default '',
+                               ip_range        text not null,
+                               first_seen_at   timestamptz not null default current_timestamp,
+                               last_seen_at    timestamptz not null default current_timestamp,
+                               unique (user_id, user_agent_hash, ip_range)
+);
+
+create table recovery_codes (
+                                id         uuid primary key default gen_random_uuid(),
+                                user_id    uuid not null references users on delete cascade,
+                                code_hash  text not null,
+                                used_at    timestamptz,
+                                created_at timestamptz not null default current_timestamp
+);
+
+create table api_keys (
+                          id           uuid primary key default gen_random_uuid(),
+                          user_id      uuid not null references users on delete cascade,
+                          name         text not null,
+                          prefix       text not null,
+                          key_hash     text not null unique,
+                          scopes       text not null default '',
+                          expires_at   timestamptz,
+                          last_used_at timestamptz,
+                          revoked_at   timestamptz,
+                          created_at   timestamptz not null default current_timestamp
+);
+
+create table security_events (
+                                 id         uuid primary key default gen_random_uuid(),
+                                 user_id    uuid references users on delete set null,
+                                 type       text not null,
+                                 outcome    text not null check (outcome in ('success', 'failure', 'denied')),
+                                 ip         text not null default '',
+                                 user_agent text not null default '',
+                                 details    jsonb,
+                                 created_at timestamptz not null default current_timestamp
+);
+
+create index security_events_user_id_idx on security_events (user_id, created_at desc);
+create index security_events_created_at_idx on security_events (created_at desc);
+
 create table tokens (
                         id    uuid primary key default gen_random_uuid(),
                         token text not null
@@ -14,9 +98,14 @@ create table tokens (
 
 create table accounts (
                           id      uuid primary key default gen_random_uuid(),
+                          name    text        not null default '',
                           number  text        not null,
+                          currency char(3)    not null default 'USD',
                           user_id uuid        not null references users on delete cascade,
                           balance decimal     not null default 0.0,
+                          metadata jsonb,
+                          -- увеличивается при каждом изменении полей владельцем (optimistic locking)
+                          version integer     not null default 1,
                           created_at timestamptz not null default current_timestamp,
                           updated_at timestamptz,
                           deleted_at timestamptz
@@ -27,7 +116,22 @@ create table transactions (
                               account_id uuid not null references accounts on delete cascade,
                               type       text not null,
                               amount     decimal not null default 0.0,
+                              currency   char(3) not null default 'USD',
+                              -- общий идентификатор операций transfer_out и transfer_in одного перевода
+                              transfer_id uuid,
                               created_at    timestamptz not null default current_timestamp,
                               updated_at    timestamptz,
                               deleted_at    timestamptz
-);
\ No newline at end of file
+);
+
+create index transactions_transfer_id_idx on transactions (transfer_id) where transfer_id is not null;
+-- дневные курсы: за 1 единицу base дают rate единиц quote
+create table fx_rates (
+                          date       date          not null,
+                          base       char(3)       not null,
+                          quote      char(3)       not null,
+                          rate       numeric(18, 8) not null check (rate > 0),
+                          source     text          not null default '',
+                          created_at timestamptz   not null default current_timestamp,
+                          primary key (base, quote, date)
+);